@@ -29,6 +29,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	if cfg.Server.APIKey == "" {
+		log.Fatal("server.api_key (API_KEY) is required")
+	}
 
 	db, err := gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{})
 	if err != nil {
@@ -47,6 +50,11 @@ func main() {
 		&models.Recipient{},
 		&models.CertificateBatch{},
 		&models.EmailTemplate{},
+		&models.TemplateVersion{},
+		&models.EmailTemplateVersion{},
+		&models.TemplateAsset{},
+		&models.JobRecord{},
+		&models.OutboxJob{},
 	)
 
 	redisClient := redis.NewClient(&redis.Options{
@@ -59,15 +67,48 @@ func main() {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
 
-	storageService, err := storage.NewLocalStorage(cfg.Storage.LocalPath, "")
+	var storageService storage.Storage
+	var localStorage *storage.LocalStorage
+	switch cfg.Storage.Type {
+	case "s3":
+		storageService, err = storage.NewS3Storage(storage.S3Options{
+			Endpoint:  cfg.Storage.S3Endpoint,
+			Region:    cfg.Storage.S3Region,
+			Bucket:    cfg.Storage.S3Bucket,
+			Prefix:    cfg.Storage.S3Prefix,
+			AccessKey: cfg.Storage.S3AccessKey,
+			SecretKey: cfg.Storage.S3SecretKey,
+			UseSSL:    !cfg.Storage.S3Insecure,
+			PathStyle: cfg.Storage.S3PathStyle,
+		})
+	case "local":
+		localStorage, err = storage.NewLocalStorage(cfg.Storage.LocalPath, cfg.Server.PublicURL+"/files", cfg.Storage.SigningKey)
+		storageService = localStorage
+	default:
+		err = fmt.Errorf("unknown storage type: %s", cfg.Storage.Type)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
-	pdfGen, err := pdf.NewHTMLGenerator("./templates/certificates")
-	if err != nil {
-		log.Fatalf("Failed to initialize PDF generator: %v", err)
+	assetService := services.NewAssetService(db, "./templates/certificates")
+
+	var htmlGen pdf.Renderer
+	if cfg.Renderer.DisableBrowser {
+		log.Println("Browser disabled; only overlay templates can be rendered")
+	} else {
+		htmlGen, err = pdf.NewHTMLGenerator("./templates/certificates", assetService, pdf.Options{
+			BrowserPath:    cfg.Renderer.BrowserPath,
+			Browsers:       cfg.Renderer.Browsers,
+			MaxConcurrent:  cfg.Renderer.MaxConcurrent,
+			HealthInterval: time.Duration(cfg.Renderer.HealthInterval) * time.Second,
+			RenderTimeout:  time.Duration(cfg.Renderer.RenderTimeout) * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize PDF generator: %v", err)
+		}
 	}
+	pdfGen := pdf.NewRouter(htmlGen, pdf.NewOverlayRenderer("./templates/certificates", assetService))
 	defer pdfGen.Close()
 
 	emailService := email.NewService(
@@ -79,7 +120,42 @@ func main() {
 		cfg.Email.FromName,
 	)
 
-	queueWorker := queue.NewWorker(redisClient, "certificate_queue", "worker-1")
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	jobTracker := services.NewJobTracker(db)
+
+	queueOptions := queue.Options{
+		VisibilityTimeout: time.Duration(cfg.Queue.VisibilityTimeout) * time.Second,
+		ReapInterval:      time.Duration(cfg.Queue.ReapInterval) * time.Second,
+		RetryPolicies:     make(map[string]queue.RetryPolicy),
+		Tracker:           jobTracker,
+	}
+	for jobType, retry := range cfg.Queue.Retry {
+		policy := queue.RetryPolicy{
+			MaxAttempts: retry.MaxAttempts,
+			BaseDelay:   time.Duration(retry.BaseDelay) * time.Second,
+			MaxDelay:    time.Duration(retry.MaxDelay) * time.Second,
+		}
+		if jobType == "default" {
+			queueOptions.DefaultRetryPolicy = policy
+		} else {
+			queueOptions.RetryPolicies[jobType] = policy
+		}
+	}
+
+	queueWorker := queue.NewWorker(redisClient, "certificate_queue", fmt.Sprintf("%s-producer", hostname), queueOptions)
+
+	var imageFormats []pdf.ImageFormat
+	for _, name := range cfg.Renderer.ImageFormats {
+		format, err := pdf.ParseImageFormat(name)
+		if err != nil {
+			log.Fatalf("Invalid renderer.image_formats: %v", err)
+		}
+		imageFormats = append(imageFormats, format)
+	}
 
 	certService := services.NewCertificateService(
 		db,
@@ -87,15 +163,43 @@ func main() {
 		emailService,
 		storageService,
 		queueWorker,
+		services.Options{
+			PublicURL:         cfg.Server.PublicURL,
+			DownloadURLExpiry: time.Duration(cfg.Storage.URLExpiry) * time.Second,
+			ImageFormats:      imageFormats,
+			ImageDPI:          cfg.Renderer.ImageDPI,
+			ImageQuality:      cfg.Renderer.ImageQuality,
+			ThumbnailWidth:    cfg.Renderer.ThumbnailWidth,
+		},
 	)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	go func() {
+		if err := queueWorker.StartReaper(ctx); err != nil && err != context.Canceled {
+			log.Printf("Reaper error: %v", err)
+		}
+	}()
+
+	go func() {
+		if err := queueWorker.StartScheduler(ctx); err != nil && err != context.Canceled {
+			log.Printf("Scheduler error: %v", err)
+		}
+	}()
+
+	go func() {
+		interval := time.Duration(cfg.Queue.OutboxInterval) * time.Second
+		if err := certService.StartOutboxRelay(ctx, interval); err != nil && err != context.Canceled {
+			log.Printf("Outbox relay error: %v", err)
+		}
+	}()
+
 	for i := 0; i < cfg.Queue.WorkerCount; i++ {
-		worker := queue.NewWorker(redisClient, "certificate_queue", fmt.Sprintf("worker-%d", i+1))
+		worker := queue.NewWorker(redisClient, "certificate_queue", fmt.Sprintf("%s-worker-%d", hostname, i+1), queueOptions)
 		worker.RegisterProcessor("generate_certificate", certService.ProcessCertificateJob)
 		worker.RegisterProcessor("send_email", certService.ProcessEmailJob)
+		worker.RegisterDeadLetterHandler("generate_certificate", certService.HandleDeadCertificateJob)
 		go func(w *queue.Worker) {
 			if err := w.Start(ctx); err != nil && err != context.Canceled {
 				log.Printf("Worker error: %v", err)
@@ -109,26 +213,71 @@ func main() {
 
 	router := gin.Default()
 	router.Use(gin.Logger(), gin.Recovery())
+	router.LoadHTMLGlob("./templates/pages/*.html")
 
 	certHandler := handlers.NewCertificateHandler(certService)
-	templateHandler := handlers.NewTemplateHandler(db)
+	templateHandler := handlers.NewTemplateHandler(services.NewTemplateService(db, pdfGen, assetService), certService)
+	assetHandler := handlers.NewAssetHandler(assetService)
+	verificationHandler := handlers.NewVerificationHandler(certService)
+	queueHandler := handlers.NewQueueHandler(queueWorker)
+	jobHandler := handlers.NewJobHandler(jobTracker)
+
+	// Verification is public; everything else under /api/v1 administers
+	// certificates and needs the API key.
+	router.GET("/api/v1/verify/:code", verificationHandler.Verify)
 
-	api := router.Group("/api/v1")
+	api := router.Group("/api/v1", handlers.RequireAPIKey(cfg.Server.APIKey))
 	{
 		api.POST("/certificates/generate", certHandler.GenerateCertificate)
 		api.POST("/certificates/bulk", certHandler.BulkGenerate)
 		api.GET("/certificates/:id", certHandler.GetCertificate)
-		api.GET("/certificates/:id/download", certHandler.DownloadCertificate)
+		api.POST("/certificates/:id/revoke", certHandler.RevokeCertificate)
+		api.POST("/certificates/:id/reissue", certHandler.ReissueCertificate)
+		api.POST("/batches/import", certHandler.ImportBatch)
 		api.GET("/batches/:id", certHandler.GetBatchStatus)
 
 		api.POST("/templates", templateHandler.CreateTemplate)
 		api.GET("/templates", templateHandler.GetTemplates)
 		api.GET("/templates/:id", templateHandler.GetTemplate)
+		api.PUT("/templates/:id", templateHandler.ReplaceTemplate)
+		api.PATCH("/templates/:id", templateHandler.UpdateTemplate)
+		api.DELETE("/templates/:id", templateHandler.DeleteTemplate)
+		api.GET("/templates/:id/versions", templateHandler.GetTemplateVersions)
+		api.GET("/templates/:id/versions/:version", templateHandler.GetTemplateVersion)
+		api.POST("/templates/:id/preview", templateHandler.PreviewTemplate)
+
+		api.POST("/template-assets", assetHandler.UploadAsset)
+		api.GET("/template-assets", assetHandler.ListAssets)
+		api.GET("/template-assets/:name", assetHandler.GetAsset)
+		api.DELETE("/template-assets/:name", assetHandler.DeleteAsset)
 
 		api.POST("/email-templates", templateHandler.CreateEmailTemplate)
 		api.GET("/email-templates", templateHandler.GetEmailTemplates)
+		api.GET("/email-templates/:id", templateHandler.GetEmailTemplate)
+		api.PUT("/email-templates/:id", templateHandler.ReplaceEmailTemplate)
+		api.PATCH("/email-templates/:id", templateHandler.UpdateEmailTemplate)
+		api.DELETE("/email-templates/:id", templateHandler.DeleteEmailTemplate)
+		api.GET("/email-templates/:id/versions", templateHandler.GetEmailTemplateVersions)
+		api.GET("/email-templates/:id/versions/:version", templateHandler.GetEmailTemplateVersion)
+
+		api.GET("/jobs", jobHandler.ListJobs)
+		api.GET("/jobs/:id", jobHandler.GetJob)
+
+		api.GET("/dead-jobs", queueHandler.ListDeadJobs)
+		api.DELETE("/dead-jobs", queueHandler.PurgeDeadJobs)
+		api.GET("/dead-jobs/:id", queueHandler.GetDeadJob)
+		api.POST("/dead-jobs/:id/requeue", queueHandler.RequeueDeadJob)
+		api.DELETE("/dead-jobs/:id", queueHandler.DeleteDeadJob)
+	}
+
+	if localStorage != nil {
+		fileHandler := handlers.NewFileHandler(localStorage)
+		router.GET("/files/*path", fileHandler.ServeFile)
 	}
 
+	router.GET("/verify/:code", verificationHandler.VerifyPage)
+	router.GET("/download/:code", certHandler.DownloadCertificate)
+
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
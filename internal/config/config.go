@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,11 +15,15 @@ type Config struct {
 	Email    EmailConfig    `yaml:"email"`
 	Storage  StorageConfig  `yaml:"storage"`
 	Queue    QueueConfig    `yaml:"queue"`
+	Renderer RendererConfig `yaml:"renderer"`
 }
 
 type ServerConfig struct {
-	Port         string `yaml:"port"`
-	Host         string `yaml:"host"`
+	Port      string `yaml:"port"`
+	Host      string `yaml:"host"`
+	PublicURL string `yaml:"public_url"`
+	// APIKey is required on every /api/v1 route except verification.
+	APIKey       string `yaml:"api_key"`
 	ReadTimeout  int    `yaml:"read_timeout"`
 	WriteTimeout int    `yaml:"write_timeout"`
 }
@@ -51,15 +56,56 @@ type EmailConfig struct {
 }
 
 type StorageConfig struct {
-	Type      string `yaml:"type"`
-	LocalPath string `yaml:"local_path"`
-	S3Bucket  string `yaml:"s3_bucket"`
-	S3Region  string `yaml:"s3_region"`
+	Type        string `yaml:"type"`
+	LocalPath   string `yaml:"local_path"`
+	S3Bucket    string `yaml:"s3_bucket"`
+	S3Region    string `yaml:"s3_region"`
+	S3Endpoint  string `yaml:"s3_endpoint"`
+	S3Prefix    string `yaml:"s3_prefix"`
+	S3AccessKey string `yaml:"s3_access_key"`
+	S3SecretKey string `yaml:"s3_secret_key"`
+	S3PathStyle bool   `yaml:"s3_path_style"`
+	S3Insecure  bool   `yaml:"s3_insecure"`
+	SigningKey  string `yaml:"signing_key"`
+	URLExpiry   int    `yaml:"url_expiry"`
 }
 
 type QueueConfig struct {
-	WorkerCount int `yaml:"worker_count"`
-	BatchSize   int `yaml:"batch_size"`
+	WorkerCount       int                    `yaml:"worker_count"`
+	BatchSize         int                    `yaml:"batch_size"`
+	VisibilityTimeout int                    `yaml:"visibility_timeout"`
+	ReapInterval      int                    `yaml:"reap_interval"`
+	OutboxInterval    int                    `yaml:"outbox_interval"`
+	Retry             map[string]RetryConfig `yaml:"retry"`
+}
+
+// RetryConfig is keyed by job type in QueueConfig.Retry; the "default" entry
+// applies to job types without their own. Delays are in seconds.
+type RetryConfig struct {
+	MaxAttempts int `yaml:"max_attempts"`
+	BaseDelay   int `yaml:"base_delay"`
+	MaxDelay    int `yaml:"max_delay"`
+}
+
+// RendererConfig sizes the Chromium pool certificates are rendered with.
+// MaxConcurrent caps renders in flight independently of queue.worker_count;
+// HealthInterval and RenderTimeout are in seconds. DisableBrowser runs
+// without Chromium, rendering only overlay (.json) templates. ImageFormats
+// (png, jpeg, webp; png if left out) are stored next to every PDF at
+// ImageDPI, along with a JPEG thumbnail ThumbnailWidth pixels wide unless
+// that is 0.
+type RendererConfig struct {
+	DisableBrowser bool   `yaml:"disable_browser"`
+	BrowserPath    string `yaml:"browser_path"`
+	Browsers       int    `yaml:"browsers"`
+	MaxConcurrent  int    `yaml:"max_concurrent"`
+	HealthInterval int    `yaml:"health_interval"`
+	RenderTimeout  int    `yaml:"render_timeout"`
+
+	ImageFormats   []string `yaml:"image_formats"`
+	ImageDPI       int      `yaml:"image_dpi"`
+	ImageQuality   int      `yaml:"image_quality"`
+	ThumbnailWidth int      `yaml:"thumbnail_width"`
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -79,6 +125,16 @@ func LoadConfig(path string) (*Config, error) {
 	if config.Server.Port == "" {
 		config.Server.Port = "8080"
 	}
+	if v := os.Getenv("API_KEY"); v != "" {
+		config.Server.APIKey = v
+	}
+	if v := os.Getenv("PUBLIC_URL"); v != "" {
+		config.Server.PublicURL = v
+	}
+	if config.Server.PublicURL == "" {
+		config.Server.PublicURL = fmt.Sprintf("http://localhost:%s", config.Server.Port)
+	}
+	config.Server.PublicURL = strings.TrimRight(config.Server.PublicURL, "/")
 
 	if v := os.Getenv("DB_HOST"); v != "" {
 		config.Database.Host = v
@@ -129,6 +185,70 @@ func LoadConfig(path string) (*Config, error) {
 		fmt.Sscanf(v, "%d", &config.Redis.Port)
 	}
 
+	if v := os.Getenv("STORAGE_TYPE"); v != "" {
+		config.Storage.Type = v
+	}
+	if config.Storage.Type == "" {
+		config.Storage.Type = "local"
+	}
+	if v := os.Getenv("S3_ENDPOINT"); v != "" {
+		config.Storage.S3Endpoint = v
+	}
+	if v := os.Getenv("S3_BUCKET"); v != "" {
+		config.Storage.S3Bucket = v
+	}
+	if v := os.Getenv("S3_REGION"); v != "" {
+		config.Storage.S3Region = v
+	}
+	if v := os.Getenv("S3_ACCESS_KEY"); v != "" {
+		config.Storage.S3AccessKey = v
+	}
+	if v := os.Getenv("S3_SECRET_KEY"); v != "" {
+		config.Storage.S3SecretKey = v
+	}
+	if v := os.Getenv("STORAGE_SIGNING_KEY"); v != "" {
+		config.Storage.SigningKey = v
+	}
+	if config.Storage.URLExpiry <= 0 {
+		config.Storage.URLExpiry = 7 * 24 * 60 * 60
+	}
+
+	if config.Queue.OutboxInterval <= 0 {
+		config.Queue.OutboxInterval = 10
+	}
+
+	if v := os.Getenv("CHROMIUM_PATH"); v != "" {
+		config.Renderer.BrowserPath = v
+	}
+	if config.Renderer.BrowserPath == "" {
+		config.Renderer.BrowserPath = "/usr/bin/chromium"
+	}
+	if config.Renderer.Browsers <= 0 {
+		config.Renderer.Browsers = 2
+	}
+	if config.Renderer.MaxConcurrent <= 0 {
+		config.Renderer.MaxConcurrent = 4
+	}
+	if config.Renderer.HealthInterval <= 0 {
+		config.Renderer.HealthInterval = 30
+	}
+	if config.Renderer.RenderTimeout <= 0 {
+		config.Renderer.RenderTimeout = 30
+	}
+	// Left out, certificates get a PNG; an empty list turns images off.
+	if config.Renderer.ImageFormats == nil {
+		config.Renderer.ImageFormats = []string{"png"}
+	}
+	if config.Renderer.ImageDPI <= 0 {
+		config.Renderer.ImageDPI = 150
+	}
+	if config.Renderer.ImageQuality <= 0 || config.Renderer.ImageQuality > 100 {
+		config.Renderer.ImageQuality = 90
+	}
+	if config.Renderer.ThumbnailWidth < 0 {
+		config.Renderer.ThumbnailWidth = 0
+	}
+
 	return &config, nil
 }
 
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigImageFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{name: "left out", yaml: "renderer:\n  image_dpi: 150\n", want: []string{"png"}},
+		{name: "turned off", yaml: "renderer:\n  image_formats: []\n", want: []string{}},
+		{name: "listed", yaml: "renderer:\n  image_formats: [jpeg, webp]\n", want: []string{"jpeg", "webp"}},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: LoadConfig: %v", tt.name, err)
+		}
+		if got := config.Renderer.ImageFormats; strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: image_formats = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"certificate-service/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxAssetSize = 5 << 20
+
+type AssetHandler struct {
+	service *services.AssetService
+}
+
+func NewAssetHandler(service *services.AssetService) *AssetHandler {
+	return &AssetHandler{service: service}
+}
+
+// UploadAsset stores the multipart "file" under its file name, or under the
+// "name" form field if given.
+func (h *AssetHandler) UploadAsset(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if fileHeader.Size > maxAssetSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAssetSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+		return
+	}
+
+	name := c.PostForm("name")
+	if name == "" {
+		name = fileHeader.Filename
+	}
+
+	asset, err := h.service.UploadAsset(name, data)
+	if err != nil {
+		c.JSON(assetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, asset)
+}
+
+func (h *AssetHandler) ListAssets(c *gin.Context) {
+	assets, err := h.service.ListAssets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, assets)
+}
+
+func (h *AssetHandler) GetAsset(c *gin.Context) {
+	asset, err := h.service.GetAsset(c.Param("name"))
+	if err != nil {
+		c.JSON(assetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, asset.ContentType, asset.Data)
+}
+
+func (h *AssetHandler) DeleteAsset(c *gin.Context) {
+	if err := h.service.DeleteAsset(c.Param("name")); err != nil {
+		c.JSON(assetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func assetErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAssetNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrAssetExists), errors.Is(err, services.ErrAssetInUse):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidAsset):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
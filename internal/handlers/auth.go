@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyHeader is an alternative to an "Authorization: Bearer" header.
+const apiKeyHeader = "X-API-Key"
+
+// RequireAPIKey rejects requests that do not carry key, as a bearer token
+// or in the X-API-Key header.
+func RequireAPIKey(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given := c.GetHeader(apiKeyHeader)
+		if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			given = strings.TrimSpace(token)
+		}
+
+		if given == "" || subtle.ConstantTimeCompare([]byte(given), []byte(key)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid API key"})
+			return
+		}
+		c.Next()
+	}
+}
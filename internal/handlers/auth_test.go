@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/v1/certificates/:id", RequireAPIKey("secret"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"code": "ABC"})
+	})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "no key", want: http.StatusUnauthorized},
+		{name: "bearer token", headers: map[string]string{"Authorization": "Bearer secret"}, want: http.StatusOK},
+		{name: "X-API-Key", headers: map[string]string{"X-API-Key": "secret"}, want: http.StatusOK},
+		{name: "wrong bearer token", headers: map[string]string{"Authorization": "Bearer secret2"}, want: http.StatusUnauthorized},
+		{name: "wrong X-API-Key", headers: map[string]string{"X-API-Key": "secre"}, want: http.StatusUnauthorized},
+		{name: "basic auth", headers: map[string]string{"Authorization": "Basic secret"}, want: http.StatusUnauthorized},
+		{name: "empty bearer token", headers: map[string]string{"Authorization": "Bearer "}, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/certificates/1", nil)
+		for key, value := range tt.headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
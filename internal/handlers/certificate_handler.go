@@ -1,15 +1,31 @@
 package handlers
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"certificate-service/internal/models"
 	"certificate-service/internal/services"
+	"certificate-service/pkg/pdf"
 	"github.com/gin-gonic/gin"
 )
 
+// downloadRedirectExpiry only has to outlive the redirect itself.
+const downloadRedirectExpiry = 5 * time.Minute
+
+const maxImportSize = 10 << 20
+
+// maxImportRequestSize leaves room for the form fields and multipart headers
+// around an import file of maxImportSize.
+const maxImportRequestSize = maxImportSize + 1<<20
+
+// idempotencyKeyHeader is an alternative to the idempotency_key request
+// field.
+const idempotencyKeyHeader = "Idempotency-Key"
+
 type CertificateHandler struct {
 	service *services.CertificateService
 }
@@ -27,20 +43,24 @@ func (h *CertificateHandler) GenerateCertificate(c *gin.Context) {
 		return
 	}
 
-	certificate, err := h.service.GenerateCertificate(c.Request.Context(), req)
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = c.GetHeader(idempotencyKeyHeader)
+	}
+
+	certificate, created, err := h.service.GenerateCertificate(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(certificateErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	response := models.CertificateResponse{
-		ID:        certificate.ID,
-		Status:    certificate.Status,
-		FilePath:  certificate.FilePath,
-		EmailSent: certificate.EmailSent,
-	}
+	response := h.newCertificateResponse(certificate)
 
-	c.JSON(http.StatusAccepted, response)
+	// An existing certificate is returned as is rather than queued again.
+	status := http.StatusAccepted
+	if !created {
+		status = http.StatusOK
+	}
+	c.JSON(status, response)
 }
 
 func (h *CertificateHandler) BulkGenerate(c *gin.Context) {
@@ -50,22 +70,109 @@ func (h *CertificateHandler) BulkGenerate(c *gin.Context) {
 		return
 	}
 
-	batch, err := h.service.BulkGenerate(c.Request.Context(), req)
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = c.GetHeader(idempotencyKeyHeader)
+	}
+
+	if req.DryRun {
+		report, err := h.service.DryRunBulkGenerate(c.Request.Context(), req)
+		if err != nil {
+			respondBatchError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	result, err := h.service.BulkGenerate(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondBatchError(c, err)
 		return
 	}
 
-	response := models.BatchStatusResponse{
-		ID:         batch.ID,
-		TotalCount: batch.TotalCount,
-		Processed:  batch.Processed,
-		Failed:     batch.Failed,
-		Status:     batch.Status,
-		Progress:   float64(batch.Processed) / float64(batch.TotalCount) * 100,
+	respondBulkResult(c, result)
+}
+
+func (h *CertificateHandler) ImportBatch(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportRequestSize)
+
+	var req models.ImportBatchRequest
+	if err := c.ShouldBind(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = c.GetHeader(idempotencyKeyHeader)
 	}
 
-	c.JSON(http.StatusAccepted, response)
+	var mapping models.ImportMapping
+	if err := json.Unmarshal([]byte(req.Mapping), &mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mapping: " + err.Error()})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if fileHeader.Size > maxImportSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	if req.DryRun {
+		report, err := h.service.DryRunImport(c.Request.Context(), file, fileHeader.Filename, req, mapping)
+		if err != nil {
+			respondBatchError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	result, err := h.service.ImportBatch(c.Request.Context(), file, fileHeader.Filename, req, mapping)
+	if err != nil {
+		respondBatchError(c, err)
+		return
+	}
+
+	respondBulkResult(c, result)
+}
+
+func respondBulkResult(c *gin.Context, result *services.BulkResult) {
+	response := newBatchStatusResponse(result.Batch)
+	response.Skipped = result.Skipped
+
+	status := http.StatusAccepted
+	if result.Existing {
+		status = http.StatusOK
+	}
+	c.JSON(status, response)
+}
+
+func respondBatchError(c *gin.Context, err error) {
+	var validationErr *services.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "rows": validationErr.Rows})
+	case errors.Is(err, services.ErrInvalidImport), errors.Is(err, services.ErrInvalidTemplateRules):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
 
 func (h *CertificateHandler) GetCertificate(c *gin.Context) {
@@ -82,13 +189,12 @@ func (h *CertificateHandler) GetCertificate(c *gin.Context) {
 		return
 	}
 
-	downloadURL := fmt.Sprintf("/api/v1/certificates/%d/download", certificate.ID)
-	response := models.CertificateResponse{
-		ID:          certificate.ID,
-		Status:      certificate.Status,
-		FilePath:    certificate.FilePath,
-		EmailSent:   certificate.EmailSent,
-		DownloadURL: downloadURL,
+	response := h.newCertificateResponse(certificate)
+
+	if certificate.Status == "completed" {
+		response.DownloadURL = h.service.DownloadLink(certificate)
+	} else {
+		response.LastError = h.service.LastError(certificate.ID)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -108,24 +214,75 @@ func (h *CertificateHandler) GetBatchStatus(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusOK, newBatchStatusResponse(batch))
+}
+
+func newBatchStatusResponse(batch *models.CertificateBatch) models.BatchStatusResponse {
 	progress := 0.0
 	if batch.TotalCount > 0 {
 		progress = float64(batch.Processed) / float64(batch.TotalCount) * 100
 	}
 
-	response := models.BatchStatusResponse{
-		ID:         batch.ID,
-		TotalCount: batch.TotalCount,
-		Processed:  batch.Processed,
-		Failed:     batch.Failed,
-		Status:     batch.Status,
-		Progress:   progress,
+	return models.BatchStatusResponse{
+		ID:          batch.ID,
+		TotalCount:  batch.TotalCount,
+		Processed:   batch.Processed,
+		Failed:      batch.Failed,
+		Revoked:     batch.Revoked,
+		Status:      batch.Status,
+		Progress:    progress,
+		CompletedAt: batch.CompletedAt,
 	}
-
-	c.JSON(http.StatusOK, response)
 }
 
+// DownloadCertificate redirects to a short-lived signed link to a
+// certificate's file. It is public, so certificates are addressed by their
+// unguessable code rather than by ID.
 func (h *CertificateHandler) DownloadCertificate(c *gin.Context) {
+	certificate, err := h.service.GetCertificateByCode(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "certificate not found"})
+		return
+	}
+
+	if certificate.Status != "completed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "certificate not ready"})
+		return
+	}
+
+	// format picks the PDF (the default), one of the images stored with it,
+	// or its thumbnail.
+	var downloadURL string
+	switch format := c.DefaultQuery("format", "pdf"); format {
+	case "pdf":
+		downloadURL, err = h.service.DownloadURL(certificate, downloadRedirectExpiry)
+	case services.ImageThumbnail:
+		downloadURL, err = h.service.ImageURL(certificate, services.ImageThumbnail, downloadRedirectExpiry)
+	default:
+		imageFormat, parseErr := pdf.ParseImageFormat(format)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be pdf, png, jpeg, webp or thumbnail"})
+			return
+		}
+		downloadURL, err = h.service.ImageURL(certificate, string(imageFormat), downloadRedirectExpiry)
+	}
+	if errors.Is(err, services.ErrImageNotEnabled) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrImageNotAvailable) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create download link"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, downloadURL)
+}
+
+func (h *CertificateHandler) RevokeCertificate(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
@@ -133,22 +290,66 @@ func (h *CertificateHandler) DownloadCertificate(c *gin.Context) {
 		return
 	}
 
-	certificate, err := h.service.GetCertificate(uint(id))
+	var req models.RevokeCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	certificate, err := h.service.RevokeCertificate(uint(id), req.Reason)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "certificate not found"})
+		c.JSON(certificateErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	if certificate.Status != "completed" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "certificate not ready"})
+	c.JSON(http.StatusOK, h.newCertificateResponse(certificate))
+}
+
+func (h *CertificateHandler) ReissueCertificate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid certificate id"})
 		return
 	}
 
-	data, err := h.service.GetStorage().Get(certificate.FilePath)
+	var req models.ReissueCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	certificate, err := h.service.ReissueCertificate(c.Request.Context(), uint(id), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read certificate"})
+		c.JSON(certificateErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Data(http.StatusOK, "application/pdf", data)
+	response := h.newCertificateResponse(certificate)
+
+	c.JSON(http.StatusAccepted, response)
+}
+
+func (h *CertificateHandler) newCertificateResponse(certificate *models.Certificate) models.CertificateResponse {
+	return models.CertificateResponse{
+		ID:               certificate.ID,
+		Code:             certificate.Code,
+		Status:           certificate.Status,
+		FilePath:         certificate.FilePath,
+		EmailSent:        certificate.EmailSent,
+		VerifyURL:        h.service.VerifyURL(certificate),
+		RevokedAt:        certificate.RevokedAt,
+		RevocationReason: certificate.RevocationReason,
+	}
+}
+
+func certificateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCertificateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidState):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
 }
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestImportBatchLimitsBodySize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/certificates/import", NewCertificateHandler(nil).ImportBatch)
+
+	tests := []struct {
+		name     string
+		fileSize int
+		want     int
+	}{
+		// The mapping is invalid, so a request that gets past the size
+		// check stops there, before the service is needed.
+		{name: "small file", fileSize: 1 << 10, want: http.StatusBadRequest},
+		{name: "file at limit", fileSize: maxImportSize, want: http.StatusBadRequest},
+		{name: "body over limit", fileSize: maxImportRequestSize + 1, want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			form.WriteField("template_id", "1")
+			form.WriteField("mapping", "not json")
+			part, err := form.CreateFormFile("file", "recipients.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write(bytes.Repeat([]byte("a"), tt.fileSize))
+			form.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/certificates/import", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"certificate-service/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FileHandler serves files from local storage behind signed links. S3
+// deployments never hit it because their links point straight at the bucket.
+type FileHandler struct {
+	storage *storage.LocalStorage
+}
+
+func NewFileHandler(storage *storage.LocalStorage) *FileHandler {
+	return &FileHandler{storage: storage}
+}
+
+func (h *FileHandler) ServeFile(c *gin.Context) {
+	filePath := strings.TrimPrefix(c.Param("path"), "/")
+
+	err := h.storage.VerifySignedURL(filePath, c.Query("expires"), c.Query("signature"))
+	if errors.Is(err, storage.ErrSignatureExpired) {
+		c.JSON(http.StatusGone, gin.H{"error": "download link expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid download link"})
+		return
+	}
+
+	fullPath, err := h.storage.LocalPath(filePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	c.FileAttachment(fullPath, path.Base(filePath))
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"certificate-service/internal/models"
+	"certificate-service/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	tracker *services.JobTracker
+}
+
+func NewJobHandler(tracker *services.JobTracker) *JobHandler {
+	return &JobHandler{tracker: tracker}
+}
+
+func (h *JobHandler) GetJob(c *gin.Context) {
+	job, err := h.tracker.GetJob(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	filter := services.JobFilter{
+		Status: c.Query("status"),
+		Type:   c.Query("type"),
+	}
+
+	for param, dest := range map[string]*uint{
+		"certificate_id": &filter.CertificateID,
+		"batch_id":       &filter.BatchID,
+	} {
+		if v := c.Query(param); v != "" {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+				return
+			}
+			*dest = uint(id)
+		}
+	}
+
+	for param, dest := range map[string]*int{
+		"limit":  &filter.Limit,
+		"offset": &filter.Offset,
+	} {
+		if v := c.Query(param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+				return
+			}
+			*dest = n
+		}
+	}
+
+	jobs, total, err := h.tracker.ListJobs(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.JobListResponse{
+		Jobs:   jobs,
+		Total:  total,
+		Offset: filter.Offset,
+	})
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"certificate-service/internal/queue"
+
+	"github.com/gin-gonic/gin"
+)
+
+type QueueHandler struct {
+	queue *queue.Worker
+}
+
+func NewQueueHandler(queue *queue.Worker) *QueueHandler {
+	return &QueueHandler{queue: queue}
+}
+
+func (h *QueueHandler) ListDeadJobs(c *gin.Context) {
+	jobs, err := h.queue.ListDeadJobs(c.Request.Context(), c.Query("type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+func (h *QueueHandler) GetDeadJob(c *gin.Context) {
+	job, err := h.queue.GetDeadJob(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, queue.ErrJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *QueueHandler) RequeueDeadJob(c *gin.Context) {
+	job, err := h.queue.RequeueDeadJob(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, queue.ErrJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *QueueHandler) DeleteDeadJob(c *gin.Context) {
+	err := h.queue.DeleteDeadJob(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, queue.ErrJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *QueueHandler) PurgeDeadJobs(c *gin.Context) {
+	n, err := h.queue.PurgeDeadJobs(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": n})
+}
@@ -1,22 +1,24 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"certificate-service/internal/models"
+	"certificate-service/internal/services"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type TemplateHandler struct {
-	db *gorm.DB
+	service     *services.TemplateService
+	certService *services.CertificateService
 }
 
-func NewTemplateHandler(db *gorm.DB) *TemplateHandler {
-	return &TemplateHandler{db: db}
+func NewTemplateHandler(service *services.TemplateService, certService *services.CertificateService) *TemplateHandler {
+	return &TemplateHandler{service: service, certService: certService}
 }
 
 func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
@@ -26,21 +28,9 @@ func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
 		return
 	}
 
-	configJSON, err := json.Marshal(req.Config)
+	template, err := h.service.CreateTemplate(req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid config format"})
-		return
-	}
-
-	template := models.Template{
-		Name:        req.Name,
-		Description: req.Description,
-		Config:      string(configJSON),
-		IsActive:    true,
-	}
-
-	if err := h.db.Create(&template).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondTemplateError(c, err)
 		return
 	}
 
@@ -48,8 +38,8 @@ func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
 }
 
 func (h *TemplateHandler) GetTemplates(c *gin.Context) {
-	var templates []models.Template
-	if err := h.db.Where("is_active = ?", true).Find(&templates).Error; err != nil {
+	templates, err := h.service.ListTemplates(c.Query("include_inactive") == "true")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -65,32 +55,169 @@ func (h *TemplateHandler) GetTemplate(c *gin.Context) {
 		return
 	}
 
-	var template models.Template
-	if err := h.db.First(&template, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+	template, err := h.service.GetTemplate(uint(id))
+	if err != nil {
+		respondTemplateError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, template)
 }
 
-func (h *TemplateHandler) CreateEmailTemplate(c *gin.Context) {
-	var req models.CreateEmailTemplateRequest
+func (h *TemplateHandler) ReplaceTemplate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template id"})
+		return
+	}
+
+	var req models.ReplaceTemplateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	emailTemplate := models.EmailTemplate{
-		Name:     req.Name,
-		Subject:  req.Subject,
-		BodyHTML: req.BodyHTML,
-		BodyText: req.BodyText,
-		IsActive: true,
+	template, err := h.service.ReplaceTemplate(uint(id), req)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
 	}
 
-	if err := h.db.Create(&emailTemplate).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	c.JSON(http.StatusOK, template)
+}
+
+func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template id"})
+		return
+	}
+
+	var req models.UpdateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := h.service.UpdateTemplate(uint(id), req)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template id"})
+		return
+	}
+
+	if err := h.service.DeleteTemplate(uint(id)); err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *TemplateHandler) GetTemplateVersions(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template id"})
+		return
+	}
+
+	versions, err := h.service.ListTemplateVersions(uint(id))
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+func (h *TemplateHandler) GetTemplateVersion(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template id"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template version"})
+		return
+	}
+
+	templateVersion, err := h.service.GetTemplateVersion(uint(id), version)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, templateVersion)
+}
+
+// PreviewTemplate renders a template without issuing a certificate. The
+// body is optional.
+func (h *TemplateHandler) PreviewTemplate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template id"})
+		return
+	}
+
+	var req models.TemplatePreviewRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Format == "" {
+		req.Format = c.DefaultQuery("format", services.PreviewFormatPDF)
+	}
+
+	var contentType string
+	switch req.Format {
+	case services.PreviewFormatPDF:
+		contentType = "application/pdf"
+	case services.PreviewFormatPNG:
+		contentType = "image/png"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be pdf or png"})
+		return
+	}
+
+	output, err := h.certService.PreviewTemplate(c.Request.Context(), uint(id), req.Version, req.Recipient, req.Format)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="template-%d-preview.%s"`, id, req.Format))
+	c.Data(http.StatusOK, contentType, output)
+}
+
+func (h *TemplateHandler) CreateEmailTemplate(c *gin.Context) {
+	var req models.CreateEmailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	emailTemplate, err := h.service.CreateEmailTemplate(req)
+	if err != nil {
+		respondTemplateError(c, err)
 		return
 	}
 
@@ -98,11 +225,151 @@ func (h *TemplateHandler) CreateEmailTemplate(c *gin.Context) {
 }
 
 func (h *TemplateHandler) GetEmailTemplates(c *gin.Context) {
-	var templates []models.EmailTemplate
-	if err := h.db.Where("is_active = ?", true).Find(&templates).Error; err != nil {
+	templates, err := h.service.ListEmailTemplates(c.Query("include_inactive") == "true")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, templates)
 }
+
+func (h *TemplateHandler) GetEmailTemplate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email template id"})
+		return
+	}
+
+	emailTemplate, err := h.service.GetEmailTemplate(uint(id))
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, emailTemplate)
+}
+
+func (h *TemplateHandler) ReplaceEmailTemplate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email template id"})
+		return
+	}
+
+	var req models.ReplaceEmailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	emailTemplate, err := h.service.ReplaceEmailTemplate(uint(id), req)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, emailTemplate)
+}
+
+func (h *TemplateHandler) UpdateEmailTemplate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email template id"})
+		return
+	}
+
+	var req models.UpdateEmailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	emailTemplate, err := h.service.UpdateEmailTemplate(uint(id), req)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, emailTemplate)
+}
+
+func (h *TemplateHandler) DeleteEmailTemplate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email template id"})
+		return
+	}
+
+	if err := h.service.DeleteEmailTemplate(uint(id)); err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *TemplateHandler) GetEmailTemplateVersions(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email template id"})
+		return
+	}
+
+	versions, err := h.service.ListEmailTemplateVersions(uint(id))
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+func (h *TemplateHandler) GetEmailTemplateVersion(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email template id"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email template version"})
+		return
+	}
+
+	emailTemplateVersion, err := h.service.GetEmailTemplateVersion(uint(id), version)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, emailTemplateVersion)
+}
+
+func respondTemplateError(c *gin.Context, err error) {
+	var validationErr *services.TemplateValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "problems": validationErr.Problems})
+		return
+	}
+	c.JSON(templateErrorStatus(err), gin.H{"error": err.Error()})
+}
+
+func templateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTemplateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrTemplateInUse), errors.Is(err, services.ErrTemplateNameTaken):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrPreviewFailed):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
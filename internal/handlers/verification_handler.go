@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"certificate-service/internal/models"
+	"certificate-service/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type VerificationHandler struct {
+	service *services.CertificateService
+}
+
+func NewVerificationHandler(service *services.CertificateService) *VerificationHandler {
+	return &VerificationHandler{service: service}
+}
+
+func (h *VerificationHandler) Verify(c *gin.Context) {
+	response, ok := h.lookup(c.Param("code"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "certificate not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *VerificationHandler) VerifyPage(c *gin.Context) {
+	response, ok := h.lookup(c.Param("code"))
+	if !ok {
+		c.HTML(http.StatusNotFound, "verify.html", gin.H{
+			"Found": false,
+			"Code":  c.Param("code"),
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "verify.html", gin.H{
+		"Found":         true,
+		"Certificate":   response,
+		"Valid":         response.Status == "valid",
+		"IssuedAtText":  formatTime(response.IssuedAt),
+		"RevokedAtText": formatTime(response.RevokedAt),
+	})
+}
+
+func (h *VerificationHandler) lookup(code string) (*models.VerificationResponse, bool) {
+	certificate, err := h.service.VerifyCertificate(code)
+	if err != nil {
+		return nil, false
+	}
+
+	status := certificate.Status
+	if status == "completed" {
+		status = "valid"
+	}
+
+	response := &models.VerificationResponse{
+		Code:             certificate.Code,
+		Status:           status,
+		Name:             certificate.Recipient.Name,
+		Event:            certificate.Recipient.Event,
+		Club:             certificate.Recipient.Club,
+		Date:             certificate.Recipient.Date,
+		IssuedAt:         certificate.IssuedAt,
+		RevokedAt:        certificate.RevokedAt,
+		RevocationReason: certificate.RevocationReason,
+		VerifyURL:        h.service.VerifyURL(certificate),
+	}
+
+	if certificate.Replaces != nil {
+		response.ReplacesCode = certificate.Replaces.Code
+	}
+	if certificate.SupersededBy != nil {
+		response.SupersededByCode = certificate.SupersededBy.Code
+		response.SupersededByURL = h.service.VerifyURL(certificate.SupersededBy)
+	}
+
+	return response, true
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format("02 Jan 2006, 15:04 MST")
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"crypto/rand"
+	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/datatypes"
@@ -9,10 +12,13 @@ import (
 
 type Certificate struct {
 	ID          uint           `gorm:"primaryKey" json:"id"`
+	Code        string         `gorm:"size:32;uniqueIndex" json:"code"`
 	TemplateID  uint           `gorm:"not null" json:"template_id"`
 	RecipientID uint           `gorm:"not null" json:"recipient_id"`
+	BatchID     *uint          `gorm:"index" json:"batch_id,omitempty"`
 	Status      string         `gorm:"not null;default:'pending'" json:"status"`
 	FilePath    string         `json:"file_path"`
+	IssuedAt    *time.Time     `json:"issued_at"`
 	EmailSent   bool           `gorm:"default:false" json:"email_sent"`
 	EmailSentAt *time.Time     `json:"email_sent_at"`
 	Metadata    datatypes.JSON `gorm:"type:jsonb" json:"metadata"`
@@ -20,8 +26,29 @@ type Certificate struct {
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 
-	Template  Template  `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
-	Recipient Recipient `gorm:"foreignKey:RecipientID" json:"recipient,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason string     `json:"revocation_reason,omitempty"`
+	ReplacesID       *uint      `gorm:"index" json:"replaces_id,omitempty"`
+	SupersededByID   *uint      `gorm:"index" json:"superseded_by_id,omitempty"`
+
+	// DedupKey identifies the template, email and event a certificate was
+	// issued for. It is cleared when the certificate is revoked or
+	// superseded, so only one live certificate can hold a given key.
+	DedupKey       *string `gorm:"size:64;uniqueIndex" json:"-"`
+	IdempotencyKey *string `gorm:"size:255;uniqueIndex" json:"idempotency_key,omitempty"`
+
+	// TemplateVersion is the template version the certificate is rendered
+	// with, 0 for certificates from before templates were versioned.
+	// EmailTemplateID and EmailTemplateVersion record the email template
+	// version it was sent with.
+	TemplateVersion      int   `gorm:"not null;default:0" json:"template_version"`
+	EmailTemplateID      *uint `json:"email_template_id,omitempty"`
+	EmailTemplateVersion int   `gorm:"not null;default:0" json:"email_template_version,omitempty"`
+
+	Template     Template     `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+	Recipient    Recipient    `gorm:"foreignKey:RecipientID" json:"recipient,omitempty"`
+	Replaces     *Certificate `gorm:"foreignKey:ReplacesID" json:"replaces,omitempty"`
+	SupersededBy *Certificate `gorm:"foreignKey:SupersededByID" json:"superseded_by,omitempty"`
 }
 
 type Template struct {
@@ -30,6 +57,7 @@ type Template struct {
 	Description string    `json:"description"`
 	Config      string    `gorm:"type:jsonb" json:"config"`
 	IsActive    bool      `gorm:"default:true" json:"is_active"`
+	Version     int       `gorm:"not null;default:1" json:"version"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -49,16 +77,19 @@ type Recipient struct {
 }
 
 type CertificateBatch struct {
-	ID         uint           `gorm:"primaryKey" json:"id"`
-	TemplateID uint           `gorm:"not null" json:"template_id"`
-	TotalCount int            `gorm:"not null" json:"total_count"`
-	Processed  int            `gorm:"default:0" json:"processed"`
-	Failed     int            `gorm:"default:0" json:"failed"`
-	Status     string         `gorm:"not null;default:'processing'" json:"status"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	Metadata   datatypes.JSON `gorm:"type:jsonb" json:"metadata"`
-	Template   Template       `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	TemplateID     uint           `gorm:"not null" json:"template_id"`
+	TotalCount     int            `gorm:"not null" json:"total_count"`
+	Processed      int            `gorm:"default:0" json:"processed"`
+	Failed         int            `gorm:"default:0" json:"failed"`
+	Revoked        int            `gorm:"default:0" json:"revoked"`
+	Status         string         `gorm:"not null;default:'processing'" json:"status"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	CompletedAt    *time.Time     `json:"completed_at,omitempty"`
+	IdempotencyKey *string        `gorm:"size:255;uniqueIndex" json:"idempotency_key,omitempty"`
+	Metadata       datatypes.JSON `gorm:"type:jsonb" json:"metadata"`
+	Template       Template       `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
 }
 
 type EmailTemplate struct {
@@ -68,6 +99,7 @@ type EmailTemplate struct {
 	BodyHTML  string    `gorm:"type:text" json:"body_html"`
 	BodyText  string    `gorm:"type:text" json:"body_text"`
 	IsActive  bool      `gorm:"default:true" json:"is_active"`
+	Version   int       `gorm:"not null;default:1" json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -76,6 +108,46 @@ func (Certificate) TableName() string {
 	return "certificates"
 }
 
+// codeAlphabet leaves out 0/O and 1/I so codes can be read off a printed
+// certificate and typed back in without ambiguity.
+const codeAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+const codeLength = 12
+
+// BeforeCreate assigns a random verification code so certificates can be
+// looked up publicly without exposing their sequential IDs.
+func (c *Certificate) BeforeCreate(tx *gorm.DB) error {
+	if c.Code != "" {
+		return nil
+	}
+	code, err := NewCertificateCode()
+	if err != nil {
+		return err
+	}
+	c.Code = code
+	return nil
+}
+
+func NewCertificateCode() (string, error) {
+	buf := make([]byte, codeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate certificate code: %w", err)
+	}
+	for i, b := range buf {
+		buf[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// NormalizeCertificateCode accepts codes as people tend to type them: lower
+// case, with dashes or spaces between groups.
+func NormalizeCertificateCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return code
+}
+
 func (Template) TableName() string {
 	return "templates"
 }
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// JobRecord is the persisted lifecycle of a queue job, keyed by the queue
+// job ID. Redis only holds jobs while they are waiting or running; this
+// table keeps what happened to them afterwards.
+type JobRecord struct {
+	ID            string     `gorm:"primaryKey;size:255" json:"id"`
+	Type          string     `gorm:"not null;index" json:"type"`
+	Status        string     `gorm:"not null;index" json:"status"`
+	CertificateID *uint      `gorm:"index" json:"certificate_id,omitempty"`
+	BatchID       *uint      `gorm:"index" json:"batch_id,omitempty"`
+	WorkerID      string     `json:"worker_id,omitempty"`
+	Attempts      int        `gorm:"default:0" json:"attempts"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	QueuedAt      time.Time  `json:"queued_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	NextRetryAt   *time.Time `json:"next_retry_at,omitempty"`
+	WaitMs        int64      `json:"wait_ms"`
+	RunMs         int64      `json:"run_ms"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (JobRecord) TableName() string {
+	return "jobs"
+}
+
+// OutboxJob is a queue job written in the same transaction as the rows it
+// refers to. It is pushed to Redis after commit and deleted once enqueued,
+// so a crash between the two leaves the job here to be retried rather than
+// lost.
+type OutboxJob struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	JobID     string         `gorm:"size:255;not null;uniqueIndex" json:"job_id"`
+	BatchID   *uint          `gorm:"index" json:"batch_id,omitempty"`
+	Payload   datatypes.JSON `gorm:"type:jsonb;not null" json:"payload"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+func (OutboxJob) TableName() string {
+	return "job_outbox"
+}
@@ -1,10 +1,21 @@
 package models
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// GenerateCertificateRequest issues one certificate. A request whose
+// IdempotencyKey, or whose template, email and event, matches an existing
+// certificate returns that certificate; Force reissues it instead.
 type GenerateCertificateRequest struct {
 	TemplateID      uint          `json:"template_id" binding:"required"`
 	Recipient       RecipientData `json:"recipient" binding:"required"`
 	SendEmail       bool          `json:"send_email"`
 	EmailTemplateID *uint         `json:"email_template_id"`
+	IdempotencyKey  string        `json:"idempotency_key"`
+	Force           bool          `json:"force"`
 }
 
 type RecipientData struct {
@@ -18,11 +29,126 @@ type RecipientData struct {
 	Metadata  map[string]interface{} `json:"metadata"`
 }
 
+// BulkGenerateRequest creates a batch. With DryRun set nothing is created;
+// the recipients are checked and the first Previews valid rows rendered.
+// Deduplication works as for GenerateCertificateRequest, per row.
 type BulkGenerateRequest struct {
 	TemplateID      uint            `json:"template_id" binding:"required"`
 	Recipients      []RecipientData `json:"recipients" binding:"required,min=1"`
 	SendEmail       bool            `json:"send_email"`
 	EmailTemplateID *uint           `json:"email_template_id"`
+	DryRun          bool            `json:"dry_run"`
+	Previews        int             `json:"previews"`
+	IdempotencyKey  string          `json:"idempotency_key"`
+	Force           bool            `json:"force"`
+	TemplateRules   []TemplateRule  `json:"template_rules"`
+}
+
+// TemplateRule picks a template for the recipients it matches. Keys of When
+// are recipient field names or "metadata.<key>"; a recipient matches when
+// every field equals one of the listed values, ignoring case and
+// surrounding spaces. Rules are tried in order and recipients matching none
+// get the request's TemplateID.
+type TemplateRule struct {
+	When       map[string]RuleValues `json:"when"`
+	TemplateID uint                  `json:"template_id"`
+}
+
+// RuleValues accepts either a single string or a list of strings.
+type RuleValues []string
+
+func (v *RuleValues) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*v = RuleValues{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("rule value must be a string or a list of strings")
+	}
+	*v = list
+	return nil
+}
+
+// ImportBatchRequest holds the form fields of a spreadsheet import; the file
+// itself is read separately. Mapping is a JSON encoded ImportMapping.
+type ImportBatchRequest struct {
+	TemplateID      uint   `form:"template_id" binding:"required"`
+	Mapping         string `form:"mapping" binding:"required"`
+	SendEmail       bool   `form:"send_email"`
+	EmailTemplateID *uint  `form:"email_template_id"`
+	DryRun          bool   `form:"dry_run"`
+	Previews        int    `form:"previews"`
+	IdempotencyKey  string `form:"idempotency_key"`
+	Force           bool   `form:"force"`
+	// TemplateRules is a JSON encoded list of TemplateRule.
+	TemplateRules string `form:"template_rules"`
+}
+
+// ImportMapping maps spreadsheet columns to recipient fields. Keys of
+// Columns are header names, or column letters (A, B, ...) when the sheet has
+// no header row. Targets are RecipientData field names (name, email, course,
+// event, club, date, student_id) or "metadata.<key>". Constants set the same
+// targets to a fixed value for every row; a non-empty mapped cell wins.
+type ImportMapping struct {
+	Columns   map[string]string `json:"columns"`
+	Constants map[string]string `json:"constants"`
+	NoHeader  bool              `json:"no_header"`
+	Sheet     string            `json:"sheet"`
+}
+
+// RowError describes one rejected field of a bulk request. Row is 1-based.
+type RowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// DryRunReport is the outcome of validating a bulk request without creating
+// anything. Errors would reject the request; Warnings are template fields a
+// row leaves empty. Templates counts the rows that would use each template.
+type DryRunReport struct {
+	Valid     bool         `json:"valid"`
+	TotalRows int          `json:"total_rows"`
+	Templates map[uint]int `json:"templates"`
+	Errors    []RowError   `json:"errors"`
+	Warnings  []RowError   `json:"warnings"`
+	Previews  []RowPreview `json:"previews"`
+}
+
+// RowPreview is a rendered row as a PNG data URI, or the error that
+// rendering it produced.
+type RowPreview struct {
+	Row        int    `json:"row"`
+	TemplateID uint   `json:"template_id"`
+	Image      string `json:"image,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SkippedRecipient is a bulk row that was not issued because a certificate
+// for the same template, email and event already exists.
+type SkippedRecipient struct {
+	Row           int    `json:"row"`
+	CertificateID uint   `json:"certificate_id"`
+	Code          string `json:"code"`
+	Status        string `json:"status"`
+}
+
+type RevokeCertificateRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ReissueCertificateRequest replaces a certificate with a corrected copy.
+// Recipient and TemplateID are optional; anything left out is copied from
+// the original certificate.
+type ReissueCertificateRequest struct {
+	Reason          string         `json:"reason" binding:"required"`
+	Recipient       *RecipientData `json:"recipient"`
+	TemplateID      *uint          `json:"template_id"`
+	SendEmail       bool           `json:"send_email"`
+	EmailTemplateID *uint          `json:"email_template_id"`
 }
 
 type CreateTemplateRequest struct {
@@ -38,19 +164,94 @@ type CreateEmailTemplateRequest struct {
 	BodyText string `json:"body_text"`
 }
 
+// ReplaceTemplateRequest is the body of PUT /templates/:id.
+type ReplaceTemplateRequest struct {
+	Name        string                 `json:"name" binding:"required"`
+	Description string                 `json:"description"`
+	Config      map[string]interface{} `json:"config" binding:"required"`
+	IsActive    *bool                  `json:"is_active"`
+}
+
+// UpdateTemplateRequest is the body of PATCH /templates/:id; fields left
+// out are unchanged.
+type UpdateTemplateRequest struct {
+	Name        *string                `json:"name"`
+	Description *string                `json:"description"`
+	Config      map[string]interface{} `json:"config"`
+	IsActive    *bool                  `json:"is_active"`
+}
+
+// ReplaceEmailTemplateRequest is the body of PUT /email-templates/:id.
+type ReplaceEmailTemplateRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Subject  string `json:"subject" binding:"required"`
+	BodyHTML string `json:"body_html" binding:"required"`
+	BodyText string `json:"body_text"`
+	IsActive *bool  `json:"is_active"`
+}
+
+// UpdateEmailTemplateRequest is the body of PATCH /email-templates/:id.
+type UpdateEmailTemplateRequest struct {
+	Name     *string `json:"name"`
+	Subject  *string `json:"subject"`
+	BodyHTML *string `json:"body_html"`
+	BodyText *string `json:"body_text"`
+	IsActive *bool   `json:"is_active"`
+}
+
+// TemplatePreviewRequest is the body of POST /templates/:id/preview. A nil
+// Recipient renders built-in sample data; Version 0 is the current version.
+type TemplatePreviewRequest struct {
+	Recipient *RecipientData `json:"recipient"`
+	Version   int            `json:"version" binding:"min=0"`
+	Format    string         `json:"format" binding:"omitempty,oneof=pdf png"`
+}
+
 type CertificateResponse struct {
 	ID          uint   `json:"id"`
+	Code        string `json:"code"`
 	Status      string `json:"status"`
 	FilePath    string `json:"file_path"`
 	EmailSent   bool   `json:"email_sent"`
 	DownloadURL string `json:"download_url,omitempty"`
+	VerifyURL   string `json:"verify_url,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason string     `json:"revocation_reason,omitempty"`
+}
+
+type VerificationResponse struct {
+	Code             string     `json:"code"`
+	Status           string     `json:"status"`
+	Name             string     `json:"name"`
+	Event            string     `json:"event"`
+	Club             string     `json:"club"`
+	Date             string     `json:"date"`
+	IssuedAt         *time.Time `json:"issued_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason string     `json:"revocation_reason,omitempty"`
+	ReplacesCode     string     `json:"replaces_code,omitempty"`
+	SupersededByCode string     `json:"superseded_by_code,omitempty"`
+	SupersededByURL  string     `json:"superseded_by_url,omitempty"`
+	VerifyURL        string     `json:"verify_url"`
 }
 
 type BatchStatusResponse struct {
-	ID         uint    `json:"id"`
-	TotalCount int     `json:"total_count"`
-	Processed  int     `json:"processed"`
-	Failed     int     `json:"failed"`
-	Status     string  `json:"status"`
-	Progress   float64 `json:"progress"`
+	ID          uint       `json:"id"`
+	TotalCount  int        `json:"total_count"`
+	Processed   int        `json:"processed"`
+	Failed      int        `json:"failed"`
+	Revoked     int        `json:"revoked"`
+	Status      string     `json:"status"`
+	Progress    float64    `json:"progress"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	Skipped []SkippedRecipient `json:"skipped,omitempty"`
+}
+
+type JobListResponse struct {
+	Jobs   []JobRecord `json:"jobs"`
+	Total  int64       `json:"total"`
+	Offset int         `json:"offset"`
 }
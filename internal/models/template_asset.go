@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// TemplateAsset is a certificate template HTML file or image uploaded
+// through the API. Template configs refer to assets by name, the same way
+// they refer to files bundled under templates/certificates.
+type TemplateAsset struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:255;not null;uniqueIndex" json:"name"`
+	ContentType string    `gorm:"size:100;not null" json:"content_type"`
+	Size        int64     `gorm:"not null" json:"size"`
+	Data        []byte    `gorm:"not null" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (TemplateAsset) TableName() string {
+	return "template_assets"
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// TemplateVersion is an immutable snapshot of a certificate template's
+// config. A template gets a new version whenever its config changes, and
+// each certificate keeps rendering with the version it was created with.
+// Files maps the bundled files the config names, which a redeploy can
+// change, to asset copies of them taken when the version was created.
+type TemplateVersion struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TemplateID uint      `gorm:"not null;uniqueIndex:idx_template_versions_template_version" json:"template_id"`
+	Version    int       `gorm:"not null;uniqueIndex:idx_template_versions_template_version" json:"version"`
+	Config     string    `gorm:"type:jsonb" json:"config"`
+	Files      string    `gorm:"type:jsonb;not null;default:'{}'" json:"files"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// EmailTemplateVersion is an immutable snapshot of an email template's
+// subject and bodies.
+type EmailTemplateVersion struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	EmailTemplateID uint      `gorm:"not null;uniqueIndex:idx_email_template_versions_template_version" json:"email_template_id"`
+	Version         int       `gorm:"not null;uniqueIndex:idx_email_template_versions_template_version" json:"version"`
+	Subject         string    `gorm:"not null" json:"subject"`
+	BodyHTML        string    `gorm:"type:text" json:"body_html"`
+	BodyText        string    `gorm:"type:text" json:"body_text"`
+	CreatedAt       time.Time `json:"created_at"`
+}
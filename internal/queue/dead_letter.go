@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+func (w *Worker) deadKey() string {
+	return w.queueName + ":dead"
+}
+
+// ListDeadJobs returns dead jobs, most recently failed first, optionally
+// filtered by job type.
+func (w *Worker) ListDeadJobs(ctx context.Context, jobType string) ([]Job, error) {
+	entries, err := w.client.HGetAll(ctx, w.deadKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead jobs: %w", err)
+	}
+
+	jobs := make([]Job, 0, len(entries))
+	for _, raw := range entries {
+		var job Job
+		if err := json.Unmarshal([]byte(raw), &job); err != nil {
+			continue
+		}
+		if jobType != "" && job.Type != jobType {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].FailedAt == nil || jobs[j].FailedAt == nil {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return jobs[i].FailedAt.After(*jobs[j].FailedAt)
+	})
+
+	return jobs, nil
+}
+
+func (w *Worker) GetDeadJob(ctx context.Context, id string) (*Job, error) {
+	raw, err := w.client.HGet(ctx, w.deadKey(), id).Result()
+	if err == redis.Nil {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead job: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal([]byte(raw), &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+	return &job, nil
+}
+
+var requeueDeadScript = redis.NewScript(`
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('LPUSH', KEYS[2], ARGV[2])
+return 1
+`)
+
+// RequeueDeadJob puts a dead job back on the queue with a fresh attempt
+// counter.
+func (w *Worker) RequeueDeadJob(ctx context.Context, id string) (*Job, error) {
+	job, err := w.GetDeadJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Attempts = 0
+	job.LastError = ""
+	job.FailedAt = nil
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	moved, err := requeueDeadScript.Run(ctx, w.client, []string{w.deadKey(), w.queueName}, id, data).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to requeue dead job: %w", err)
+	}
+	if moved == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	w.options.Tracker.JobQueued(ctx, *job)
+	return job, nil
+}
+
+func (w *Worker) DeleteDeadJob(ctx context.Context, id string) error {
+	n, err := w.client.HDel(ctx, w.deadKey(), id).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete dead job: %w", err)
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// PurgeDeadJobs deletes every dead job and reports how many were removed.
+// The count and delete run in one transaction, so jobs that die in between
+// are neither missed from the count nor left behind.
+func (w *Worker) PurgeDeadJobs(ctx context.Context) (int64, error) {
+	var count *redis.IntCmd
+	_, err := w.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.HLen(ctx, w.deadKey())
+		pipe.Del(ctx, w.deadKey())
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge dead jobs: %w", err)
+	}
+	return count.Val(), nil
+}
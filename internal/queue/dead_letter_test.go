@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRequeueDeadJob(t *testing.T) {
+	w, mr := newTestWorker(t, "w1", Options{})
+	ctx := context.Background()
+
+	failedAt := time.Now()
+	dead := Job{ID: "job-1", Type: "test", Attempts: 3, LastError: "smtp timeout", FailedAt: &failedAt}
+	mr.HSet(w.deadKey(), dead.ID, mustMarshal(t, dead))
+
+	job, err := w.RequeueDeadJob(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("RequeueDeadJob: %v", err)
+	}
+	if job.Attempts != 0 || job.LastError != "" || job.FailedAt != nil {
+		t.Errorf("requeued job %+v, want a fresh attempt counter", job)
+	}
+	queued := listJobs(t, mr, w.queueName)
+	if len(queued) != 1 || queued[0].ID != "job-1" || queued[0].Attempts != 0 {
+		t.Errorf("queue holds %+v, want job-1 with no attempts", queued)
+	}
+	if _, err := w.GetDeadJob(ctx, "job-1"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetDeadJob after requeue = %v, want ErrJobNotFound", err)
+	}
+
+	if _, err := w.RequeueDeadJob(ctx, "job-1"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("second RequeueDeadJob = %v, want ErrJobNotFound", err)
+	}
+	if queued := listJobs(t, mr, w.queueName); len(queued) != 1 {
+		t.Errorf("queue holds %d jobs after a second requeue, want 1", len(queued))
+	}
+}
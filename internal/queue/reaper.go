@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func (w *Worker) processingKey(workerID string) string {
+	return fmt.Sprintf("%s:processing:%s", w.queueName, workerID)
+}
+
+func (w *Worker) heartbeatKey(workerID string) string {
+	return fmt.Sprintf("%s:heartbeat:%s", w.queueName, workerID)
+}
+
+func (w *Worker) workersKey() string {
+	return w.queueName + ":workers"
+}
+
+func (w *Worker) reaperLockKey() string {
+	return w.queueName + ":reaper"
+}
+
+func (w *Worker) heartbeat(ctx context.Context) error {
+	pipe := w.client.TxPipeline()
+	pipe.SAdd(ctx, w.workersKey(), w.workerID)
+	pipe.Set(ctx, w.heartbeatKey(w.workerID), time.Now().Unix(), w.options.VisibilityTimeout)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+	return nil
+}
+
+func (w *Worker) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(w.options.VisibilityTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.heartbeat(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Worker %s: %v", w.workerID, err)
+			}
+		}
+	}
+}
+
+// StartReaper periodically returns jobs held by workers whose heartbeat has
+// expired to the queue. Every process may run one; a short Redis lock keeps
+// them from reaping at the same time.
+func (w *Worker) StartReaper(ctx context.Context) error {
+	ticker := time.NewTicker(w.options.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			n, err := w.ReapDeadWorkers(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Reaper: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("Reaper: requeued %d jobs from dead workers", n)
+			}
+		}
+	}
+}
+
+func (w *Worker) ReapDeadWorkers(ctx context.Context) (int, error) {
+	locked, err := w.client.SetNX(ctx, w.reaperLockKey(), w.workerID, w.options.ReapInterval).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire reaper lock: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	workerIDs, err := w.client.SMembers(ctx, w.workersKey()).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list workers: %w", err)
+	}
+
+	total := 0
+	for _, workerID := range workerIDs {
+		alive, err := w.client.Exists(ctx, w.heartbeatKey(workerID)).Result()
+		if err != nil {
+			return total, fmt.Errorf("failed to check heartbeat: %w", err)
+		}
+		if alive > 0 {
+			continue
+		}
+
+		n, err := w.requeueProcessing(ctx, workerID)
+		total += n
+		if err != nil {
+			return total, err
+		}
+
+		if err := w.client.SRem(ctx, w.workersKey(), workerID).Err(); err != nil {
+			return total, fmt.Errorf("failed to remove dead worker: %w", err)
+		}
+	}
+
+	return total, nil
+}
+
+// requeueProcessing moves every job in a worker's processing list back to
+// the consuming end of the queue so recovered jobs run next.
+func (w *Worker) requeueProcessing(ctx context.Context, workerID string) (int, error) {
+	count := 0
+	for {
+		raw, err := w.client.LMove(ctx, w.processingKey(workerID), w.queueName, "RIGHT", "RIGHT").Result()
+		if err == redis.Nil {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to requeue jobs for %s: %w", workerID, err)
+		}
+		count++
+
+		var job Job
+		if err := json.Unmarshal([]byte(raw), &job); err == nil {
+			w.options.Tracker.JobQueued(ctx, job)
+		}
+	}
+}
+
+var requeueStrandedScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('RPUSH', KEYS[2], ARGV[2])
+return 1
+`)
+
+// requeueStranded replaces the worker's stranded jobs in its processing list
+// with their updated payloads at the consuming end of the queue. A job no
+// longer in the processing list was recorded after all and is skipped.
+func (w *Worker) requeueStranded(ctx context.Context) (int, error) {
+	count := 0
+	for raw, data := range w.stranded {
+		moved, err := requeueStrandedScript.Run(ctx, w.client,
+			[]string{w.processingKey(w.workerID), w.queueName}, raw, data,
+		).Int()
+		if err != nil {
+			return count, fmt.Errorf("failed to requeue stranded job: %w", err)
+		}
+		delete(w.stranded, raw)
+		if moved == 0 {
+			continue
+		}
+		count++
+
+		var job Job
+		if err := json.Unmarshal([]byte(data), &job); err == nil {
+			w.options.Tracker.JobQueued(ctx, job)
+		}
+	}
+	return count, nil
+}
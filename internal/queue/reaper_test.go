@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReapDeadWorkers(t *testing.T) {
+	const timeout = 30 * time.Second
+	tests := []struct {
+		name       string
+		elapsed    time.Duration
+		wantReaped int
+	}{
+		{"heartbeat alive", timeout / 2, 0},
+		{"heartbeat expired", timeout + time.Second, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := Options{VisibilityTimeout: timeout}
+			dead, mr := newTestWorker(t, "dead", options)
+			reaper := newTestWorkerOn(t, mr, "reaper", options)
+			ctx := context.Background()
+
+			if err := dead.heartbeat(ctx); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []string{"job-1", "job-2"} {
+				if _, err := mr.Lpush(dead.processingKey("dead"), mustMarshal(t, Job{ID: id, Type: "test"})); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := reaper.Enqueue(ctx, Job{ID: "job-3", Type: "test"}); err != nil {
+				t.Fatal(err)
+			}
+
+			mr.FastForward(tt.elapsed)
+			// The reaper's own heartbeat is fresh.
+			if err := reaper.heartbeat(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			n, err := reaper.ReapDeadWorkers(ctx)
+			if err != nil {
+				t.Fatalf("ReapDeadWorkers: %v", err)
+			}
+			if n != tt.wantReaped {
+				t.Errorf("reaped %d jobs, want %d", n, tt.wantReaped)
+			}
+
+			members, err := mr.Members(reaper.workersKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantWorkers := 2
+			if tt.wantReaped > 0 {
+				wantWorkers = 1
+			}
+			if len(members) != wantWorkers {
+				t.Errorf("workers %v, want %d", members, wantWorkers)
+			}
+
+			queued := jobIDs(listJobs(t, mr, reaper.queueName))
+			held := listJobs(t, mr, dead.processingKey("dead"))
+			if tt.wantReaped == 0 {
+				if len(held) != 2 || len(queued) != 1 {
+					t.Errorf("queue %v, processing %v; want the live worker's jobs left alone", queued, jobIDs(held))
+				}
+				return
+			}
+			// Reaped jobs go to the consuming end, ahead of queued ones.
+			if len(held) != 0 || len(queued) != 3 || queued[2] != "job-3" {
+				t.Errorf("queue %v, processing %v; want the reaped jobs ahead of job-3 and nothing held", queued, jobIDs(held))
+			}
+		})
+	}
+}
+
+func TestReapDeadWorkersTakesLock(t *testing.T) {
+	options := Options{VisibilityTimeout: 30 * time.Second}
+	dead, mr := newTestWorker(t, "dead", options)
+	first := newTestWorkerOn(t, mr, "first", options)
+	second := newTestWorkerOn(t, mr, "second", options)
+	ctx := context.Background()
+
+	if _, err := first.ReapDeadWorkers(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// dead's heartbeat has lapsed, but first still holds the reaper lock.
+	if err := dead.heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mr.Del(dead.heartbeatKey("dead"))
+	if _, err := mr.Lpush(dead.processingKey("dead"), mustMarshal(t, Job{ID: "job-1", Type: "test"})); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := second.ReapDeadWorkers(ctx); err != nil || n != 0 {
+		t.Errorf("ReapDeadWorkers under another reaper's lock = %d, %v; want 0, nil", n, err)
+	}
+
+	mr.FastForward(options.VisibilityTimeout / 2)
+	if n, err := second.ReapDeadWorkers(ctx); err != nil || n != 1 {
+		t.Errorf("ReapDeadWorkers once the lock expired = %d, %v; want 1, nil", n, err)
+	}
+}
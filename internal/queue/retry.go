@@ -0,0 +1,201 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 5 * time.Second
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 5 * time.Minute
+	}
+	return p
+}
+
+// Backoff returns the delay before the given retry (1 for the first retry),
+// doubling each time up to MaxDelay with +/-20% jitter so a batch that failed
+// together does not retry in lockstep.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	jitter := 0.8 + rand.Float64()*0.4
+	return time.Duration(delay * jitter)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying; the job goes straight to
+// the dead-letter queue.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+func (w *Worker) delayedKey() string {
+	return w.queueName + ":delayed"
+}
+
+func (w *Worker) retryPolicy(job Job) RetryPolicy {
+	policy, ok := w.options.RetryPolicies[job.Type]
+	if !ok {
+		policy = w.options.DefaultRetryPolicy
+	}
+	policy = policy.withDefaults()
+	if job.MaxAttempts > 0 {
+		policy.MaxAttempts = job.MaxAttempts
+	}
+	return policy
+}
+
+// recordFailureAttempts is how many times fail tries to move a failed job
+// out of the processing list before leaving it to be requeued.
+const recordFailureAttempts = 3
+
+// fail records a failed attempt and either schedules the job for a delayed
+// retry or moves it to the dead-letter queue. The job leaves the processing
+// list in the same transaction so it is never in two places at once. If
+// Redis keeps refusing the move, the job is left in the processing list and
+// the worker requeues it, with this attempt counted, before taking another
+// job; the reaper only reclaims jobs from dead workers.
+func (w *Worker) fail(ctx context.Context, raw string, job Job, jobErr error, duration time.Duration) {
+	now := time.Now()
+	job.Attempts++
+	job.LastError = jobErr.Error()
+
+	policy := w.retryPolicy(job)
+	retry := !IsPermanent(jobErr) && job.Attempts < policy.MaxAttempts
+	if !retry {
+		job.FailedAt = &now
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("Worker %s: failed to marshal job %s: %v", w.workerID, job.ID, err)
+		w.ack(raw)
+		return
+	}
+
+	readyAt := now.Add(policy.Backoff(job.Attempts))
+
+	record := func() error {
+		writeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		pipe := w.client.TxPipeline()
+		pipe.LRem(writeCtx, w.processingKey(w.workerID), 1, raw)
+		if retry {
+			pipe.ZAdd(writeCtx, w.delayedKey(), &redis.Z{
+				Score:  float64(readyAt.UnixMilli()),
+				Member: data,
+			})
+		} else {
+			pipe.HSet(writeCtx, w.deadKey(), job.ID, data)
+		}
+		_, err := pipe.Exec(writeCtx)
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = record()
+		if err == nil {
+			break
+		}
+		if attempt == recordFailureAttempts {
+			log.Printf("Worker %s: failed to record failure of job %s, leaving it to be requeued: %v", w.workerID, job.ID, err)
+			stranded := job
+			stranded.FailedAt = nil
+			if data, err := json.Marshal(stranded); err == nil {
+				w.stranded[raw] = string(data)
+			}
+			return
+		}
+		time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+	}
+
+	if retry {
+		log.Printf("Worker %s: job %s failed (attempt %d/%d), will retry: %v", w.workerID, job.ID, job.Attempts, policy.MaxAttempts, jobErr)
+		w.options.Tracker.JobRetrying(ctx, job, duration, readyAt)
+		return
+	}
+
+	log.Printf("Worker %s: job %s moved to dead-letter queue after %d attempts: %v", w.workerID, job.ID, job.Attempts, jobErr)
+	w.options.Tracker.JobDead(ctx, job, duration)
+	if handler, ok := w.deadLetters[job.Type]; ok {
+		handler(ctx, job, jobErr)
+	}
+}
+
+var promoteDelayedScript = redis.NewScript(`
+local jobs = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, job in ipairs(jobs) do
+	redis.call('ZREM', KEYS[1], job)
+	redis.call('LPUSH', KEYS[2], job)
+end
+return #jobs
+`)
+
+// PromoteDelayed moves retries whose backoff has elapsed back onto the
+// queue. The move happens in a Lua script, so any number of schedulers can
+// run at once without duplicating jobs.
+func (w *Worker) PromoteDelayed(ctx context.Context) (int, error) {
+	n, err := promoteDelayedScript.Run(ctx, w.client,
+		[]string{w.delayedKey(), w.queueName},
+		time.Now().UnixMilli(), 100,
+	).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to promote delayed jobs: %w", err)
+	}
+	return n, nil
+}
+
+func (w *Worker) StartScheduler(ctx context.Context) error {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := w.PromoteDelayed(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Scheduler: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{20, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			got := policy.Backoff(tt.attempt)
+			low, high := time.Duration(float64(tt.want)*0.8), time.Duration(float64(tt.want)*1.2)
+			if got < low || got > high {
+				t.Errorf("Backoff(%d) = %v, want %v +/-20%%", tt.attempt, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestPromoteDelayed(t *testing.T) {
+	w, mr := newTestWorker(t, "w1", Options{})
+	ctx := context.Background()
+
+	now := time.Now()
+	if _, err := mr.ZAdd(w.delayedKey(), float64(now.Add(-time.Second).UnixMilli()), mustMarshal(t, Job{ID: "ready", Type: "test"})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mr.ZAdd(w.delayedKey(), float64(now.Add(time.Hour).UnixMilli()), mustMarshal(t, Job{ID: "waiting", Type: "test"})); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := w.PromoteDelayed(ctx)
+	if err != nil {
+		t.Fatalf("PromoteDelayed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("promoted %d jobs, want 1", n)
+	}
+	if ids := jobIDs(listJobs(t, mr, w.queueName)); len(ids) != 1 || ids[0] != "ready" {
+		t.Errorf("queue holds %v, want [ready]", ids)
+	}
+	if members, _ := mr.ZMembers(w.delayedKey()); len(members) != 1 {
+		t.Errorf("delayed set holds %d jobs, want the one still waiting", len(members))
+	}
+}
+
+// delayedJobs returns the jobs waiting out their backoff.
+func delayedJobs(t *testing.T, mr *miniredis.Miniredis, w *Worker) []Job {
+	t.Helper()
+	if !mr.Exists(w.delayedKey()) {
+		return nil
+	}
+	members, err := mr.ZMembers(w.delayedKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := make([]Job, len(members))
+	for i, member := range members {
+		if err := json.Unmarshal([]byte(member), &jobs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return jobs
+}
+
+func TestFailRetriesUntilDeadLetter(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantRuns int
+	}{
+		{"transient error", errors.New("smtp timeout"), 3},
+		{"permanent error", Permanent(errors.New("template missing")), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, mr := newTestWorker(t, "w1", Options{
+				DefaultRetryPolicy: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			})
+			ctx := context.Background()
+
+			runs := 0
+			w.RegisterProcessor("test", func(context.Context, Job) error {
+				runs++
+				return tt.err
+			})
+			var deadJob *Job
+			var deadErr error
+			w.RegisterDeadLetterHandler("test", func(_ context.Context, job Job, err error) {
+				deadJob, deadErr = &job, err
+			})
+
+			if err := w.Enqueue(ctx, Job{ID: "job-1", Type: "test"}); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 5 && deadJob == nil; i++ {
+				if err := w.processNext(ctx); err != nil {
+					t.Fatalf("processNext: %v", err)
+				}
+				if deadJob != nil {
+					break
+				}
+				delayed := delayedJobs(t, mr, w)
+				if len(delayed) != 1 || delayed[0].Attempts != runs || delayed[0].LastError != tt.err.Error() {
+					t.Fatalf("after run %d the delayed set holds %+v, want job-1 with %d attempts", runs, delayed, runs)
+				}
+				time.Sleep(5 * time.Millisecond)
+				if _, err := w.PromoteDelayed(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if runs != tt.wantRuns {
+				t.Errorf("job ran %d times, want %d", runs, tt.wantRuns)
+			}
+			if deadJob == nil || deadJob.Attempts != tt.wantRuns || deadJob.FailedAt == nil || !errors.Is(deadErr, tt.err) {
+				t.Fatalf("dead-letter handler got %+v, %v; want job-1 after %d attempts", deadJob, deadErr, tt.wantRuns)
+			}
+			stored, err := w.GetDeadJob(ctx, "job-1")
+			if err != nil {
+				t.Fatalf("GetDeadJob: %v", err)
+			}
+			if stored.Attempts != tt.wantRuns || stored.LastError != tt.err.Error() {
+				t.Errorf("dead job has %d attempts and error %q, want %d and %q", stored.Attempts, stored.LastError, tt.wantRuns, tt.err.Error())
+			}
+			if n := len(delayedJobs(t, mr, w)) + len(listJobs(t, mr, w.queueName)) + len(listJobs(t, mr, w.processingKey("w1"))); n != 0 {
+				t.Errorf("%d copies of the job left outside the dead-letter queue", n)
+			}
+		})
+	}
+}
+
+func TestStrandedJobCountsAttempt(t *testing.T) {
+	w, mr := newTestWorker(t, "w1", Options{
+		DefaultRetryPolicy: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	})
+	ctx := context.Background()
+
+	runs := 0
+	w.RegisterProcessor("test", func(context.Context, Job) error {
+		runs++
+		if runs == 1 {
+			// Redis goes away before the failure can be recorded.
+			mr.SetError("connection lost")
+		}
+		return errors.New("smtp timeout")
+	})
+	if err := w.Enqueue(ctx, Job{ID: "job-1", Type: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.processNext(ctx); err != nil {
+		t.Fatalf("processNext: %v", err)
+	}
+	if len(w.stranded) != 1 {
+		t.Fatalf("%d stranded jobs, want 1", len(w.stranded))
+	}
+	mr.SetError("")
+
+	n, err := w.requeueStranded(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("requeueStranded = %d, %v; want 1, nil", n, err)
+	}
+	queued := listJobs(t, mr, w.queueName)
+	if len(queued) != 1 || queued[0].Attempts != 1 {
+		t.Fatalf("queue holds %+v, want job-1 with its attempt counted", queued)
+	}
+	if held := listJobs(t, mr, w.processingKey("w1")); len(held) != 0 {
+		t.Errorf("processing list holds %v, want it empty", jobIDs(held))
+	}
+
+	// The second failure uses up the attempts.
+	if err := w.processNext(ctx); err != nil {
+		t.Fatalf("processNext: %v", err)
+	}
+	if _, err := w.GetDeadJob(ctx, "job-1"); err != nil {
+		t.Errorf("GetDeadJob after the second failure: %v", err)
+	}
+}
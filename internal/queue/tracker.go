@@ -0,0 +1,25 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Tracker is notified of job lifecycle transitions so they can be recorded
+// outside Redis. Implementations should log their own errors; a tracker
+// failure never fails the job.
+type Tracker interface {
+	JobQueued(ctx context.Context, job Job)
+	JobStarted(ctx context.Context, job Job, workerID string)
+	JobSucceeded(ctx context.Context, job Job, duration time.Duration)
+	JobRetrying(ctx context.Context, job Job, duration time.Duration, retryAt time.Time)
+	JobDead(ctx context.Context, job Job, duration time.Duration)
+}
+
+type noopTracker struct{}
+
+func (noopTracker) JobQueued(context.Context, Job)                             {}
+func (noopTracker) JobStarted(context.Context, Job, string)                    {}
+func (noopTracker) JobSucceeded(context.Context, Job, time.Duration)           {}
+func (noopTracker) JobRetrying(context.Context, Job, time.Duration, time.Time) {}
+func (noopTracker) JobDead(context.Context, Job, time.Duration)                {}
@@ -4,33 +4,77 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
 type Job struct {
-	ID        string                 `json:"id"`
-	Type      string                 `json:"type"`
-	Data      map[string]interface{} `json:"data"`
-	CreatedAt time.Time              `json:"created_at"`
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	Data        map[string]interface{} `json:"data"`
+	CreatedAt   time.Time              `json:"created_at"`
+	Attempts    int                    `json:"attempts"`
+	MaxAttempts int                    `json:"max_attempts,omitempty"`
+	LastError   string                 `json:"last_error,omitempty"`
+	FailedAt    *time.Time             `json:"failed_at,omitempty"`
 }
 
 type Worker struct {
-	client     *redis.Client
-	queueName  string
-	workerID   string
-	processors map[string]JobProcessor
+	client      *redis.Client
+	queueName   string
+	workerID    string
+	processors  map[string]JobProcessor
+	deadLetters map[string]DeadLetterHandler
+	options     Options
+
+	// stranded holds failed jobs that could not be taken off the processing
+	// list, keyed by their payload there, with the failed attempt counted.
+	// They are requeued before the next job.
+	stranded map[string]string
+}
+
+type Options struct {
+	// VisibilityTimeout is how long a worker may go without a heartbeat
+	// before the jobs it holds are handed to other workers.
+	VisibilityTimeout time.Duration
+	// ReapInterval is how often the reaper looks for dead workers.
+	ReapInterval time.Duration
+	// RetryPolicies holds per job type retry settings; job types without an
+	// entry use DefaultRetryPolicy.
+	RetryPolicies      map[string]RetryPolicy
+	DefaultRetryPolicy RetryPolicy
+	// Tracker records job lifecycle transitions; nil disables tracking.
+	Tracker Tracker
 }
 
 type JobProcessor func(ctx context.Context, job Job) error
 
-func NewWorker(client *redis.Client, queueName, workerID string) *Worker {
+// DeadLetterHandler runs once a job has used up its attempts (or failed
+// permanently) and has been moved to the dead-letter queue.
+type DeadLetterHandler func(ctx context.Context, job Job, err error)
+
+func NewWorker(client *redis.Client, queueName, workerID string, options Options) *Worker {
+	if options.VisibilityTimeout <= 0 {
+		options.VisibilityTimeout = 60 * time.Second
+	}
+	if options.ReapInterval <= 0 {
+		options.ReapInterval = options.VisibilityTimeout / 2
+	}
+	options.DefaultRetryPolicy = options.DefaultRetryPolicy.withDefaults()
+	if options.Tracker == nil {
+		options.Tracker = noopTracker{}
+	}
+
 	return &Worker{
-		client:     client,
-		queueName:  queueName,
-		workerID:   workerID,
-		processors: make(map[string]JobProcessor),
+		client:      client,
+		queueName:   queueName,
+		workerID:    workerID,
+		processors:  make(map[string]JobProcessor),
+		deadLetters: make(map[string]DeadLetterHandler),
+		options:     options,
+		stranded:    make(map[string]string),
 	}
 }
 
@@ -38,22 +82,52 @@ func (w *Worker) RegisterProcessor(jobType string, processor JobProcessor) {
 	w.processors[jobType] = processor
 }
 
+func (w *Worker) RegisterDeadLetterHandler(jobType string, handler DeadLetterHandler) {
+	w.deadLetters[jobType] = handler
+}
+
 func (w *Worker) Start(ctx context.Context) error {
+	if err := w.heartbeat(ctx); err != nil {
+		return err
+	}
+
+	// Anything still in our processing list was left behind by a previous
+	// run under the same worker ID; nothing can be working on it now.
+	if n, err := w.requeueProcessing(ctx, w.workerID); err != nil {
+		log.Printf("Worker %s: failed to recover in-flight jobs: %v", w.workerID, err)
+	} else if n > 0 {
+		log.Printf("Worker %s: recovered %d in-flight jobs from previous run", w.workerID, n)
+	}
+
+	go w.keepAlive(ctx)
+
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			if err := w.processNext(ctx); err != nil {
+			if len(w.stranded) > 0 {
+				n, err := w.requeueStranded(ctx)
+				if err != nil {
+					log.Printf("Worker %s: %v", w.workerID, err)
+					time.Sleep(1 * time.Second)
+					continue
+				}
+				log.Printf("Worker %s: requeued %d jobs left in its processing list", w.workerID, n)
+			}
+
+			// Failed jobs wait out their backoff in the delayed set, so only
+			// trouble reaching Redis is worth pausing for.
+			if err := w.processNext(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Worker %s: %v", w.workerID, err)
 				time.Sleep(1 * time.Second)
-				continue
 			}
 		}
 	}
 }
 
 func (w *Worker) processNext(ctx context.Context) error {
-	result, err := w.client.BRPop(ctx, 5*time.Second, w.queueName).Result()
+	raw, err := w.client.BLMove(ctx, w.queueName, w.processingKey(w.workerID), "RIGHT", "LEFT", 5*time.Second).Result()
 	if err == redis.Nil {
 		return nil
 	}
@@ -61,33 +135,83 @@ func (w *Worker) processNext(ctx context.Context) error {
 		return fmt.Errorf("failed to pop from queue: %w", err)
 	}
 
-	if len(result) < 2 {
+	var job Job
+	if err := json.Unmarshal([]byte(raw), &job); err != nil {
+		log.Printf("Worker %s: dropping unreadable job: %v", w.workerID, err)
+		w.ack(raw)
 		return nil
 	}
 
-	var job Job
-	if err := json.Unmarshal([]byte(result[1]), &job); err != nil {
-		return fmt.Errorf("failed to unmarshal job: %w", err)
-	}
+	started := time.Now()
+	w.options.Tracker.JobStarted(ctx, job, w.workerID)
 
 	processor, ok := w.processors[job.Type]
 	if !ok {
-		return fmt.Errorf("unknown job type: %s", job.Type)
+		w.fail(ctx, raw, job, Permanent(fmt.Errorf("unknown job type: %s", job.Type)), time.Since(started))
+		return nil
 	}
 
-	if err := processor(ctx, job); err != nil {
-		return fmt.Errorf("job processing failed: %w", err)
+	if err := runProcessor(ctx, processor, job); err != nil {
+		// Shutting down mid-job is not the job's fault: put it back at the
+		// head of the queue for the next worker.
+		if ctx.Err() != nil {
+			w.requeue(raw)
+			w.options.Tracker.JobQueued(ctx, job)
+			return ctx.Err()
+		}
+		w.fail(ctx, raw, job, err, time.Since(started))
+		return nil
 	}
 
+	w.ack(raw)
+	w.options.Tracker.JobSucceeded(ctx, job, time.Since(started))
 	return nil
 }
 
+// runProcessor turns a panic in a processor into a job error, so one bad
+// job cannot take the worker, and the server, down with it.
+func runProcessor(ctx context.Context, processor JobProcessor, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return processor(ctx, job)
+}
+
+// ack removes a job from the processing list once the worker is done with
+// it. It uses a fresh context so a shutdown does not leave it half-done.
+func (w *Worker) ack(raw string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := w.client.LRem(ctx, w.processingKey(w.workerID), 1, raw).Err(); err != nil {
+		log.Printf("Worker %s: failed to ack job: %v", w.workerID, err)
+	}
+}
+
+func (w *Worker) requeue(raw string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipe := w.client.TxPipeline()
+	pipe.LRem(ctx, w.processingKey(w.workerID), 1, raw)
+	pipe.RPush(ctx, w.queueName, raw)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Worker %s: failed to requeue job: %v", w.workerID, err)
+	}
+}
+
 func (w *Worker) Enqueue(ctx context.Context, job Job) error {
 	data, err := json.Marshal(job)
 	if err != nil {
 		return fmt.Errorf("failed to marshal job: %w", err)
 	}
 
+	// Record the job before it becomes visible so a fast worker cannot
+	// report it started before it was ever queued.
+	w.options.Tracker.JobQueued(ctx, job)
+
 	if err := w.client.LPush(ctx, w.queueName, data).Err(); err != nil {
 		return fmt.Errorf("failed to enqueue job: %w", err)
 	}
@@ -102,6 +226,7 @@ func (w *Worker) EnqueueBatch(ctx context.Context, jobs []Job) error {
 		if err != nil {
 			continue
 		}
+		w.options.Tracker.JobQueued(ctx, job)
 		pipe.LPush(ctx, w.queueName, data)
 	}
 	_, err := pipe.Exec(ctx)
@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestWorker returns a worker on an in-memory Redis, which the test can
+// use to inspect keys and move the clock forward.
+func newTestWorker(t *testing.T, workerID string, options Options) (*Worker, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return newTestWorkerOn(t, mr, workerID, options), mr
+}
+
+func newTestWorkerOn(t *testing.T, mr *miniredis.Miniredis, workerID string, options Options) *Worker {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewWorker(client, "jobs", workerID, options)
+}
+
+func mustMarshal(t *testing.T, job Job) string {
+	t.Helper()
+	data, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// listJobs returns the jobs in a Redis list, from the consuming end first.
+func listJobs(t *testing.T, mr *miniredis.Miniredis, key string) []Job {
+	t.Helper()
+	if !mr.Exists(key) {
+		return nil
+	}
+	raw, err := mr.List(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := make([]Job, 0, len(raw))
+	for i := len(raw) - 1; i >= 0; i-- {
+		var job Job
+		if err := json.Unmarshal([]byte(raw[i]), &job); err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+func jobIDs(jobs []Job) []string {
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	return ids
+}
+
+func TestProcessNextHoldsJobInProcessingList(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"success", nil},
+		{"failure", errors.New("render failed")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, mr := newTestWorker(t, "w1", Options{})
+			ctx := context.Background()
+
+			var queued, processing []Job
+			w.RegisterProcessor("test", func(ctx context.Context, job Job) error {
+				queued = listJobs(t, mr, w.queueName)
+				processing = listJobs(t, mr, w.processingKey(w.workerID))
+				return tt.err
+			})
+			if err := w.Enqueue(ctx, Job{ID: "job-1", Type: "test"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.processNext(ctx); err != nil {
+				t.Fatalf("processNext: %v", err)
+			}
+
+			if len(queued) != 0 {
+				t.Errorf("queue held %v while the job ran, want it empty", jobIDs(queued))
+			}
+			if ids := jobIDs(processing); len(ids) != 1 || ids[0] != "job-1" {
+				t.Errorf("processing list held %v while the job ran, want [job-1]", ids)
+			}
+			if left := listJobs(t, mr, w.processingKey(w.workerID)); len(left) != 0 {
+				t.Errorf("processing list holds %v after the job, want it empty", jobIDs(left))
+			}
+		})
+	}
+}
+
+func TestStartRecoversOwnProcessingList(t *testing.T) {
+	w, mr := newTestWorker(t, "w1", Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A previous run under the same ID died holding job-1; job-2 was queued
+	// after it.
+	if _, err := mr.Lpush(w.processingKey("w1"), mustMarshal(t, Job{ID: "job-1", Type: "test"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Enqueue(ctx, Job{ID: "job-2", Type: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ran := make(chan string, 2)
+	w.RegisterProcessor("test", func(_ context.Context, job Job) error {
+		ran <- job.ID
+		cancel()
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- w.Start(ctx) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Start = %v, want context.Canceled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Start did not return")
+	}
+
+	if got := <-ran; got != "job-1" {
+		t.Errorf("first job run was %s, want the recovered job-1", got)
+	}
+	if ids := jobIDs(listJobs(t, mr, w.queueName)); len(ids) != 1 || ids[0] != "job-2" {
+		t.Errorf("queue holds %v, want [job-2]", ids)
+	}
+	if left := listJobs(t, mr, w.processingKey("w1")); len(left) != 0 {
+		t.Errorf("processing list holds %v, want it empty", jobIDs(left))
+	}
+}
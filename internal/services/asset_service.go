@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"certificate-service/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrAssetNotFound = errors.New("asset not found")
+	ErrAssetExists   = errors.New("asset already exists")
+	ErrAssetInUse    = errors.New("asset is in use")
+	ErrInvalidAsset  = errors.New("invalid asset")
+)
+
+// assetContentTypes lists the file types that can be uploaded, by
+// extension.
+var assetContentTypes = map[string]string{
+	".html": "text/html; charset=utf-8",
+	".htm":  "text/html; charset=utf-8",
+	".svg":  "image/svg+xml",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".webp": "image/webp",
+	".gif":  "image/gif",
+	".json": "application/json",
+	".ttf":  "font/ttf",
+}
+
+// AssetService stores certificate templates, images and fonts uploaded through
+// the API. Assets are immutable: certificates keep rendering with the files
+// their template version names, so an asset cannot be replaced, and cannot
+// be deleted while a template refers to it.
+type AssetService struct {
+	db         *gorm.DB
+	bundledDir string
+}
+
+// NewAssetService creates an AssetService. bundledDir is the directory of
+// templates shipped with the service; uploads may not shadow its files,
+// since the generator looks there first.
+func NewAssetService(db *gorm.DB, bundledDir string) *AssetService {
+	return &AssetService{db: db, bundledDir: bundledDir}
+}
+
+func (s *AssetService) UploadAsset(name string, data []byte) (*models.TemplateAsset, error) {
+	if name == "" || name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("%w: name must be a plain file name", ErrInvalidAsset)
+	}
+	contentType, ok := assetContentTypes[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported file type %q", ErrInvalidAsset, filepath.Ext(name))
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidAsset)
+	}
+	if strings.HasPrefix(contentType, "text/html") {
+		if _, err := template.New(name).Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAsset, err)
+		}
+	}
+	if contentType == "application/json" && !json.Valid(data) {
+		return nil, fmt.Errorf("%w: file is not valid JSON", ErrInvalidAsset)
+	}
+	if s.isBundled(name) {
+		return nil, fmt.Errorf("%w: %s is a bundled file", ErrAssetExists, name)
+	}
+
+	asset := models.TemplateAsset{
+		Name:        name,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Data:        data,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.TemplateAsset{}).Where("name = ?", name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s", ErrAssetExists, name)
+		}
+		if err := tx.Create(&asset).Error; err != nil {
+			return fmt.Errorf("failed to store asset: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &asset, nil
+}
+
+// ListAssets returns every uploaded asset without its content.
+func (s *AssetService) ListAssets() ([]models.TemplateAsset, error) {
+	var assets []models.TemplateAsset
+	if err := s.db.Omit("data").Order("name").Find(&assets).Error; err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+func (s *AssetService) GetAsset(name string) (*models.TemplateAsset, error) {
+	var asset models.TemplateAsset
+	err := s.db.Where("name = ?", name).First(&asset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAssetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// DeleteAsset removes an asset no template version refers to.
+func (s *AssetService) DeleteAsset(name string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var asset models.TemplateAsset
+		err := tx.Omit("data").Where("name = ?", name).First(&asset).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAssetNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// Asset names appear as JSON string values in template configs.
+		pattern := "%" + fmt.Sprintf("%q", name) + "%"
+		var templates, versions int64
+		if err := tx.Model(&models.Template{}).Where("CAST(config AS TEXT) LIKE ?", pattern).Count(&templates).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.TemplateVersion{}).Where("CAST(config AS TEXT) LIKE ? OR CAST(files AS TEXT) LIKE ?", pattern, pattern).Count(&versions).Error; err != nil {
+			return err
+		}
+		if templates > 0 || versions > 0 {
+			return fmt.Errorf("%w: %s is referenced by a template", ErrAssetInUse, name)
+		}
+
+		if err := tx.Delete(&asset).Error; err != nil {
+			return fmt.Errorf("failed to delete asset: %w", err)
+		}
+		return nil
+	})
+}
+
+// Asset implements pdf.AssetStore.
+func (s *AssetService) Asset(name string) ([]byte, bool, error) {
+	var asset models.TemplateAsset
+	err := s.db.Select("data").Where("name = ?", name).First(&asset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return asset.Data, true, nil
+}
+
+func (s *AssetService) isBundled(name string) bool {
+	return s.bundledPath(name) != ""
+}
+
+// bundledPath returns the bundled file the generator would load for name,
+// or "" if there is none.
+func (s *AssetService) bundledPath(name string) string {
+	if !filepath.IsLocal(name) {
+		return ""
+	}
+	for _, path := range []string{
+		filepath.Join(s.bundledDir, name),
+		filepath.Join(s.bundledDir, "images", name),
+	} {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// snapshotBundled copies a bundled file into an asset named after its
+// content and returns the asset's name, or "" if name is not bundled.
+// Identical copies are shared.
+func (s *AssetService) snapshotBundled(tx *gorm.DB, name string) (string, error) {
+	path := s.bundledPath(name)
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	sum := sha256.Sum256(data)
+	ext := filepath.Ext(name)
+	snapshot := fmt.Sprintf("%s-%x%s", strings.TrimSuffix(filepath.Base(name), ext), sum[:8], ext)
+
+	contentType, ok := assetContentTypes[strings.ToLower(ext)]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	asset := models.TemplateAsset{
+		Name:        snapshot,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Data:        data,
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&asset)
+	if result.Error != nil {
+		return "", fmt.Errorf("failed to store copy of %s: %w", name, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return snapshot, nil
+	}
+
+	// The name is taken, normally by an earlier copy of the same file.
+	var existing models.TemplateAsset
+	if err := tx.Where("name = ?", snapshot).First(&existing).Error; err != nil {
+		return "", err
+	}
+	if !bytes.Equal(existing.Data, data) {
+		return "", fmt.Errorf("%w: %s", ErrAssetExists, snapshot)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"certificate-service/internal/models"
+	"certificate-service/pkg/spreadsheet"
+)
+
+// ErrInvalidImport is returned for uploads that cannot be read or mapped at
+// all, as opposed to individual rows failing validation.
+var ErrInvalidImport = errors.New("invalid import")
+
+var recipientFields = map[string]bool{
+	"name":       true,
+	"email":      true,
+	"course":     true,
+	"event":      true,
+	"club":       true,
+	"date":       true,
+	"student_id": true,
+}
+
+// ImportBatch reads recipients from a CSV or XLSX file using the given column
+// mapping and creates a batch from them. Row numbers in validation errors
+// are spreadsheet row numbers, counting the header.
+func (s *CertificateService) ImportBatch(ctx context.Context, file io.Reader, filename string, req models.ImportBatchRequest, mapping models.ImportMapping) (*BulkResult, error) {
+	recipients, rows, err := readRecipients(file, filename, mapping)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseTemplateRules(req.TemplateRules)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bulkGenerate(ctx, models.BulkGenerateRequest{
+		TemplateID:      req.TemplateID,
+		Recipients:      recipients,
+		SendEmail:       req.SendEmail,
+		EmailTemplateID: req.EmailTemplateID,
+		IdempotencyKey:  req.IdempotencyKey,
+		Force:           req.Force,
+		TemplateRules:   rules,
+	}, rows)
+}
+
+func parseTemplateRules(encoded string) ([]models.TemplateRule, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	var rules []models.TemplateRule
+	if err := json.Unmarshal([]byte(encoded), &rules); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplateRules, err)
+	}
+	return rules, nil
+}
+
+// DryRunImport checks a spreadsheet import like ImportBatch without creating
+// anything.
+func (s *CertificateService) DryRunImport(ctx context.Context, file io.Reader, filename string, req models.ImportBatchRequest, mapping models.ImportMapping) (*models.DryRunReport, error) {
+	recipients, rows, err := readRecipients(file, filename, mapping)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseTemplateRules(req.TemplateRules)
+	if err != nil {
+		return nil, err
+	}
+	return s.dryRun(ctx, req.TemplateID, rules, recipients, rows, req.Previews)
+}
+
+// readRecipients maps spreadsheet rows to recipients, skipping blank rows.
+// It also returns the spreadsheet row number of each recipient.
+func readRecipients(file io.Reader, filename string, mapping models.ImportMapping) ([]models.RecipientData, []int, error) {
+	rows, err := spreadsheet.Read(file, filename, mapping.Sheet)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+
+	var header []string
+	first := 0
+	if !mapping.NoHeader && len(rows) > 0 {
+		header = rows[0]
+		first = 1
+	}
+
+	columns, err := resolveColumns(mapping, header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var recipients []models.RecipientData
+	var rowNumbers []int
+	for i := first; i < len(rows); i++ {
+		row := rows[i]
+		if isBlankRow(row) {
+			continue
+		}
+
+		var recipient models.RecipientData
+		for target, value := range mapping.Constants {
+			setRecipientField(&recipient, target, value)
+		}
+		for index, target := range columns {
+			if index < len(row) && row[index] != "" {
+				setRecipientField(&recipient, target, row[index])
+			}
+		}
+
+		recipients = append(recipients, recipient)
+		rowNumbers = append(rowNumbers, i+1)
+	}
+
+	if len(recipients) == 0 {
+		return nil, nil, fmt.Errorf("%w: file has no recipient rows", ErrInvalidImport)
+	}
+
+	return recipients, rowNumbers, nil
+}
+
+// resolveColumns turns the mapping's column keys into column indexes and
+// checks that every target is a known field.
+func resolveColumns(mapping models.ImportMapping, header []string) (map[int]string, error) {
+	if len(mapping.Columns) == 0 {
+		return nil, fmt.Errorf("%w: mapping has no columns", ErrInvalidImport)
+	}
+
+	mapped := make(map[string]bool)
+	for target := range mapping.Constants {
+		if !isRecipientTarget(target) {
+			return nil, fmt.Errorf("%w: unknown field %q in constants", ErrInvalidImport, target)
+		}
+		mapped[target] = true
+	}
+
+	columns := make(map[int]string, len(mapping.Columns))
+	for column, target := range mapping.Columns {
+		if !isRecipientTarget(target) {
+			return nil, fmt.Errorf("%w: unknown field %q for column %q", ErrInvalidImport, target, column)
+		}
+
+		index := headerIndex(header, column)
+		if index < 0 {
+			index = spreadsheet.ColumnIndex(column)
+		}
+		if index < 0 || (header != nil && index >= len(header)) {
+			return nil, fmt.Errorf("%w: column %q not found", ErrInvalidImport, column)
+		}
+		if other, ok := columns[index]; ok {
+			return nil, fmt.Errorf("%w: column %q is mapped to both %q and %q", ErrInvalidImport, column, other, target)
+		}
+
+		columns[index] = target
+		mapped[target] = true
+	}
+
+	for _, required := range []string{"name", "email"} {
+		if !mapped[required] {
+			return nil, fmt.Errorf("%w: no column or constant for %q", ErrInvalidImport, required)
+		}
+	}
+
+	return columns, nil
+}
+
+func headerIndex(header []string, column string) int {
+	for i, name := range header {
+		if strings.EqualFold(name, strings.TrimSpace(column)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isRecipientTarget(target string) bool {
+	if key, ok := strings.CutPrefix(target, "metadata."); ok {
+		return key != ""
+	}
+	return recipientFields[target]
+}
+
+func setRecipientField(recipient *models.RecipientData, target, value string) {
+	if key, ok := strings.CutPrefix(target, "metadata."); ok {
+		if recipient.Metadata == nil {
+			recipient.Metadata = make(map[string]interface{})
+		}
+		recipient.Metadata[key] = value
+		return
+	}
+
+	switch target {
+	case "name":
+		recipient.Name = value
+	case "email":
+		recipient.Email = value
+	case "course":
+		recipient.Course = value
+	case "event":
+		recipient.Event = value
+	case "club":
+		recipient.Club = value
+	case "date":
+		recipient.Date = value
+	case "student_id":
+		recipient.StudentID = value
+	}
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"certificate-service/internal/models"
+)
+
+func TestReadRecipients(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		mapping  models.ImportMapping
+		want     []models.RecipientData
+		wantRows []int
+	}{
+		{
+			name: "header names",
+			data: "Full Name,E-mail,Course\nAda Lovelace,ada@example.com,CSE\n",
+			mapping: models.ImportMapping{Columns: map[string]string{
+				"full name": "name", "E-mail": "email", "Course": "course",
+			}},
+			want:     []models.RecipientData{{Name: "Ada Lovelace", Email: "ada@example.com", Course: "CSE"}},
+			wantRows: []int{2},
+		},
+		{
+			name: "column letters with a header",
+			data: "Name,Email\nAda Lovelace,ada@example.com\n",
+			mapping: models.ImportMapping{Columns: map[string]string{
+				"A": "name", "b": "email",
+			}},
+			want:     []models.RecipientData{{Name: "Ada Lovelace", Email: "ada@example.com"}},
+			wantRows: []int{2},
+		},
+		{
+			name: "no header",
+			data: "Ada Lovelace,ada@example.com,42\n,,\nGrace Hopper,grace@example.com,7\n",
+			mapping: models.ImportMapping{NoHeader: true, Columns: map[string]string{
+				"A": "name", "B": "email", "C": "metadata.score",
+			}},
+			want: []models.RecipientData{
+				{Name: "Ada Lovelace", Email: "ada@example.com", Metadata: map[string]interface{}{"score": "42"}},
+				{Name: "Grace Hopper", Email: "grace@example.com", Metadata: map[string]interface{}{"score": "7"}},
+			},
+			wantRows: []int{1, 3},
+		},
+		{
+			name: "constants fill empty cells",
+			data: "Name,Email,Event\nAda Lovelace,ada@example.com,\nGrace Hopper,grace@example.com,Hackathon\n",
+			mapping: models.ImportMapping{
+				Columns:   map[string]string{"Name": "name", "Email": "email", "Event": "event"},
+				Constants: map[string]string{"event": "Workshop", "club": "Coding Club"},
+			},
+			want: []models.RecipientData{
+				{Name: "Ada Lovelace", Email: "ada@example.com", Event: "Workshop", Club: "Coding Club"},
+				{Name: "Grace Hopper", Email: "grace@example.com", Event: "Hackathon", Club: "Coding Club"},
+			},
+			wantRows: []int{2, 3},
+		},
+		{
+			name: "constant for a required field",
+			data: "Name\nAda Lovelace\n",
+			mapping: models.ImportMapping{
+				Columns:   map[string]string{"Name": "name"},
+				Constants: map[string]string{"email": "events@example.com"},
+			},
+			want:     []models.RecipientData{{Name: "Ada Lovelace", Email: "events@example.com"}},
+			wantRows: []int{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rows, err := readRecipients(strings.NewReader(tt.data), "recipients.csv", tt.mapping)
+			if err != nil {
+				t.Fatalf("readRecipients: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recipients = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(rows, tt.wantRows) {
+				t.Errorf("rows = %v, want %v", rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestReadRecipientsRejectsMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		mapping models.ImportMapping
+		want    string
+	}{
+		{
+			name:    "no columns",
+			data:    "Name,Email\nAda,ada@example.com\n",
+			mapping: models.ImportMapping{Constants: map[string]string{"name": "Ada", "email": "ada@example.com"}},
+			want:    "mapping has no columns",
+		},
+		{
+			name:    "unknown column",
+			data:    "Name,Email\nAda,ada@example.com\n",
+			mapping: models.ImportMapping{Columns: map[string]string{"Name": "name", "Mail": "email"}},
+			want:    `column "Mail" not found`,
+		},
+		{
+			name:    "letter past the header",
+			data:    "Name,Email\nAda,ada@example.com\n",
+			mapping: models.ImportMapping{Columns: map[string]string{"A": "name", "C": "email"}},
+			want:    `column "C" not found`,
+		},
+		{
+			name:    "unknown field",
+			data:    "Name,Email\nAda,ada@example.com\n",
+			mapping: models.ImportMapping{Columns: map[string]string{"Name": "name", "Email": "mail"}},
+			want:    `unknown field "mail"`,
+		},
+		{
+			name: "unknown constant",
+			data: "Name,Email\nAda,ada@example.com\n",
+			mapping: models.ImportMapping{
+				Columns:   map[string]string{"Name": "name", "Email": "email"},
+				Constants: map[string]string{"metadata.": "x"},
+			},
+			want: `unknown field "metadata." in constants`,
+		},
+		{
+			name:    "column mapped twice",
+			data:    "Name,Email\nAda,ada@example.com\n",
+			mapping: models.ImportMapping{Columns: map[string]string{"Email": "email", "B": "metadata.contact", "Name": "name"}},
+			want:    "is mapped to both",
+		},
+		{
+			name:    "no email",
+			data:    "Name,Email\nAda,ada@example.com\n",
+			mapping: models.ImportMapping{Columns: map[string]string{"Name": "name"}},
+			want:    `no column or constant for "email"`,
+		},
+		{
+			name:    "only blank rows",
+			data:    "Name,Email\n,\n",
+			mapping: models.ImportMapping{Columns: map[string]string{"Name": "name", "Email": "email"}},
+			want:    "file has no recipient rows",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readRecipients(strings.NewReader(tt.data), "recipients.csv", tt.mapping)
+			if !errors.Is(err, ErrInvalidImport) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("readRecipients = %v, want ErrInvalidImport mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"certificate-service/internal/models"
+	"certificate-service/internal/queue"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// batchCounter reports which batch counter a certificate status belongs to.
+// Pending certificates have not been counted yet. Revoking or reissuing a
+// certificate is an admin decision, not a generation failure, so revoked and
+// superseded certificates have a count of their own.
+func batchCounter(status string) string {
+	switch status {
+	case "completed":
+		return "processed"
+	case "failed":
+		return "failed"
+	case "revoked", "superseded":
+		return "revoked"
+	default:
+		return ""
+	}
+}
+
+// transitionCertificate moves a certificate to a new status under a row lock
+// and applies the matching batch counter change in the same transaction,
+// writing followUp jobs to the outbox with it. It returns false without
+// changing anything when the certificate is not in one of the allowed
+// statuses, which makes redelivered jobs harmless.
+func (s *CertificateService) transitionCertificate(id uint, fallbackBatchID *uint, allowedFrom []string, to string, fields map[string]interface{}, followUp ...queue.Job) (bool, error) {
+	var completedBatch *uint
+	changed := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var certificate models.Certificate
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&certificate, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCertificateNotFound
+			}
+			return err
+		}
+
+		allowed := false
+		for _, status := range allowedFrom {
+			if certificate.Status == status {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil
+		}
+
+		updates := map[string]interface{}{"status": to}
+		for k, v := range fields {
+			updates[k] = v
+		}
+
+		batchID := certificate.BatchID
+		if batchID == nil && fallbackBatchID != nil {
+			batchID = fallbackBatchID
+			updates["batch_id"] = *batchID
+		}
+
+		// Updates writes the new status into certificate, so keep the old one.
+		from := certificate.Status
+		if err := tx.Model(&certificate).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update certificate: %w", err)
+		}
+		changed = true
+
+		for _, job := range followUp {
+			if err := addOutboxJob(tx, job, nil); err != nil {
+				return err
+			}
+		}
+
+		completed, err := applyBatchTransition(tx, batchID, from, to)
+		if err != nil {
+			return err
+		}
+		if completed {
+			completedBatch = batchID
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if completedBatch != nil {
+		s.batchCompleted(*completedBatch)
+	}
+
+	return changed, nil
+}
+
+// applyBatchTransition adjusts a batch's counters for one certificate moving
+// between statuses using in-database increments, then flips the batch to its
+// final status. The conditional update on status = 'processing' succeeds for
+// exactly one caller, which is reported by the returned bool.
+func applyBatchTransition(tx *gorm.DB, batchID *uint, from, to string) (bool, error) {
+	if batchID == nil || *batchID == 0 {
+		return false, nil
+	}
+
+	fromCounter, toCounter := batchCounter(from), batchCounter(to)
+	if fromCounter == toCounter {
+		return false, nil
+	}
+
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	if fromCounter != "" {
+		updates[fromCounter] = gorm.Expr(fromCounter + " - 1")
+	}
+	if toCounter != "" {
+		updates[toCounter] = gorm.Expr(toCounter + " + 1")
+	}
+
+	if err := tx.Model(&models.CertificateBatch{}).Where("id = ?", *batchID).Updates(updates).Error; err != nil {
+		return false, fmt.Errorf("failed to update batch counters: %w", err)
+	}
+
+	// A batch failed if every certificate that was not revoked failed.
+	finalStatus := gorm.Expr("CASE WHEN failed > 0 AND failed >= total_count - revoked THEN 'failed' ELSE 'completed' END")
+
+	result := tx.Model(&models.CertificateBatch{}).
+		Where("id = ? AND status = ? AND processed + failed + revoked >= total_count", *batchID, "processing").
+		Updates(map[string]interface{}{
+			"status":       finalStatus,
+			"completed_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to complete batch: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// A failed certificate that was requeued and later succeeded can turn a
+	// finished batch from failed into completed.
+	if err := tx.Model(&models.CertificateBatch{}).
+		Where("id = ? AND status IN ?", *batchID, []string{"completed", "failed"}).
+		Update("status", finalStatus).Error; err != nil {
+		return false, fmt.Errorf("failed to update batch status: %w", err)
+	}
+
+	return false, nil
+}
+
+func (s *CertificateService) batchCompleted(batchID uint) {
+	var batch models.CertificateBatch
+	if err := s.db.First(&batch, batchID).Error; err != nil {
+		return
+	}
+	log.Printf("Batch %d %s: %d processed, %d failed, %d revoked of %d", batch.ID, batch.Status, batch.Processed, batch.Failed, batch.Revoked, batch.TotalCount)
+}
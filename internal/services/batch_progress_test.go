@@ -0,0 +1,191 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"certificate-service/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB returns an empty database with the certificate tables. It uses
+// the Postgres server at POSTGRES_TEST_DSN, in a schema of its own, when that
+// is set, so row locks are exercised for real; otherwise a SQLite file whose
+// transactions take the write lock up front.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+
+	var db *gorm.DB
+	if dsn := os.Getenv("POSTGRES_TEST_DSN"); dsn != "" {
+		schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+		admin, err := gorm.Open(postgres.Open(dsn), config)
+		if err != nil {
+			t.Fatalf("failed to connect to Postgres: %v", err)
+		}
+		if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+			t.Fatalf("failed to create schema: %v", err)
+		}
+		t.Cleanup(func() {
+			admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+			if sqlDB, err := admin.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+
+		db, err = gorm.Open(postgres.Open(dsn+" search_path="+schema), config)
+		if err != nil {
+			t.Fatalf("failed to connect to Postgres: %v", err)
+		}
+	} else {
+		path := filepath.Join(t.TempDir(), "test.db")
+		var err error
+		db, err = gorm.Open(sqlite.Open(path+"?_pragma=busy_timeout(30000)&_pragma=journal_mode(WAL)&_txlock=immediate"), config)
+		if err != nil {
+			t.Fatalf("failed to open SQLite: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := db.AutoMigrate(
+		&models.Template{},
+		&models.Recipient{},
+		&models.CertificateBatch{},
+		&models.Certificate{},
+		&models.OutboxJob{},
+		&models.TemplateVersion{},
+		&models.TemplateAsset{},
+	); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+func TestTransitionCertificateConcurrentWorkers(t *testing.T) {
+	const (
+		certificates = 200
+		workers      = 16
+		deliveries   = 2 // every job is delivered twice, as after a reaped worker
+	)
+
+	db := openTestDB(t)
+	s := &CertificateService{db: db}
+
+	template := models.Template{Name: "concurrency", Config: "{}"}
+	if err := db.Create(&template).Error; err != nil {
+		t.Fatal(err)
+	}
+	recipient := models.Recipient{Name: "Ada Lovelace", Email: "ada@example.com"}
+	if err := db.Create(&recipient).Error; err != nil {
+		t.Fatal(err)
+	}
+	batch := models.CertificateBatch{TemplateID: template.ID, TotalCount: certificates, Status: "processing"}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]uint, certificates)
+	for i := range ids {
+		certificate := models.Certificate{
+			TemplateID:  template.ID,
+			RecipientID: recipient.ID,
+			BatchID:     &batch.ID,
+			Status:      "pending",
+		}
+		if err := db.Create(&certificate).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = certificate.ID
+	}
+
+	// Count the updates that complete the batch: the ones that set
+	// completed_at and matched a row.
+	var completions atomic.Int32
+	err := db.Callback().Update().After("gorm:update").Register("test:count_batch_completions", func(tx *gorm.DB) {
+		updates, ok := tx.Statement.Dest.(map[string]interface{})
+		if tx.Error != nil || tx.Statement.Table != "certificate_batches" || !ok {
+			return
+		}
+		if _, ok := updates["completed_at"]; ok && tx.Statement.RowsAffected > 0 {
+			completions.Add(1)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every fifth certificate fails; the rest complete.
+	outcome := func(i int) (string, []string) {
+		if i%5 == 0 {
+			return "failed", []string{"pending"}
+		}
+		return "completed", []string{"pending", "failed"}
+	}
+
+	jobs := make(chan int)
+	var changed atomic.Int32
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				to, from := outcome(i)
+				ok, err := s.transitionCertificate(ids[i], &batch.ID, from, to, map[string]interface{}{"issued_at": time.Now()})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if ok {
+					changed.Add(1)
+				}
+			}
+		}()
+	}
+	for d := 0; d < deliveries; d++ {
+		for i := range ids {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("transitionCertificate: %v", err)
+	}
+
+	if got := changed.Load(); got != certificates {
+		t.Errorf("%d transitions changed a certificate, want %d", got, certificates)
+	}
+
+	if err := db.First(&batch, batch.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	wantFailed := (certificates + 4) / 5
+	if batch.Processed+batch.Failed != batch.TotalCount {
+		t.Errorf("processed %d + failed %d != total %d", batch.Processed, batch.Failed, batch.TotalCount)
+	}
+	if batch.Processed != certificates-wantFailed || batch.Failed != wantFailed {
+		t.Errorf("processed %d, failed %d; want %d, %d", batch.Processed, batch.Failed, certificates-wantFailed, wantFailed)
+	}
+	if batch.Status != "completed" || batch.CompletedAt == nil {
+		t.Errorf("batch status %q, completed_at %v; want completed with a time", batch.Status, batch.CompletedAt)
+	}
+	if got := completions.Load(); got != 1 {
+		t.Errorf("batch completed %d times, want once", got)
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"certificate-service/internal/models"
+	"certificate-service/pkg/pdf"
+)
+
+var (
+	// ErrImageNotAvailable is returned for images a certificate was not
+	// stored with.
+	ErrImageNotAvailable = errors.New("image not available")
+	// ErrImageNotEnabled is returned for images of a format the service is
+	// not configured to store.
+	ErrImageNotEnabled = errors.New("image format not enabled")
+)
+
+// ImageThumbnail is the small JPEG stored with certificates for listing UIs.
+const ImageThumbnail = "thumbnail"
+
+// imageSuffixes are the endings of the files stored next to a certificate
+// PDF, by image variant.
+var imageSuffixes = map[string]string{
+	string(pdf.ImagePNG):  ".png",
+	string(pdf.ImageJPEG): ".jpg",
+	string(pdf.ImageWebP): ".webp",
+	ImageThumbnail:        ".thumb.jpg",
+}
+
+func imagePath(pdfPath, variant string) string {
+	return strings.TrimSuffix(pdfPath, ".pdf") + imageSuffixes[variant]
+}
+
+// renderImages renders the configured images of a certificate, keyed by
+// variant. Formats the template's renderer cannot produce are skipped.
+func (s *CertificateService) renderImages(ctx context.Context, templateName string, data map[string]string) (map[string][]byte, error) {
+	var variants []string
+	var options []pdf.ImageOptions
+	for _, format := range s.options.ImageFormats {
+		variants = append(variants, string(format))
+		options = append(options, pdf.ImageOptions{Format: format, DPI: float64(s.options.ImageDPI), Quality: s.options.ImageQuality})
+	}
+	if s.options.ThumbnailWidth > 0 {
+		variants = append(variants, ImageThumbnail)
+		options = append(options, pdf.ImageOptions{Format: pdf.ImageJPEG, Width: s.options.ThumbnailWidth, Quality: s.options.ImageQuality})
+	}
+	if len(options) == 0 {
+		return nil, nil
+	}
+
+	images, err := s.pdfGen.GenerateImages(ctx, templateName, data, options)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make(map[string][]byte, len(images))
+	for i, image := range images {
+		if image == nil {
+			log.Printf("Template %s cannot be rendered as %s, skipping", templateName, variants[i])
+			continue
+		}
+		rendered[variants[i]] = image
+	}
+	return rendered, nil
+}
+
+// saveImages stores rendered images next to the certificate PDF at pdfPath.
+func (s *CertificateService) saveImages(pdfPath string, images map[string][]byte) error {
+	for variant, image := range images {
+		if err := s.storage.Put(imagePath(pdfPath, variant), image); err != nil {
+			return fmt.Errorf("failed to save %s image: %w", variant, err)
+		}
+	}
+	return nil
+}
+
+// deleteFiles removes a certificate PDF and any images stored with it.
+func (s *CertificateService) deleteFiles(pdfPath string, images map[string][]byte) {
+	s.storage.Delete(pdfPath)
+	for variant := range images {
+		s.storage.Delete(imagePath(pdfPath, variant))
+	}
+}
+
+// imageEnabled reports whether new certificates are stored with an image
+// variant.
+func (s *CertificateService) imageEnabled(variant string) bool {
+	if variant == ImageThumbnail {
+		return s.options.ThumbnailWidth > 0
+	}
+	for _, format := range s.options.ImageFormats {
+		if string(format) == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageURL returns a signed link to an image stored with a certificate:
+// "png", "jpeg", "webp" or "thumbnail". A zero expiry uses the configured
+// default.
+func (s *CertificateService) ImageURL(certificate *models.Certificate, variant string, expiry time.Duration) (string, error) {
+	if certificate.FilePath == "" {
+		return "", fmt.Errorf("certificate file not generated yet")
+	}
+	if _, ok := imageSuffixes[variant]; !ok {
+		return "", fmt.Errorf("%w: unknown image %q", ErrImageNotAvailable, variant)
+	}
+
+	path := imagePath(certificate.FilePath, variant)
+	exists, err := s.storage.Exists(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up %s image: %w", variant, err)
+	}
+	if !exists {
+		// Images stored before a format was turned off stay available.
+		if !s.imageEnabled(variant) {
+			return "", fmt.Errorf("%w: %s images are not stored; see renderer.image_formats", ErrImageNotEnabled, variant)
+		}
+		if variant == string(pdf.ImageWebP) {
+			return "", fmt.Errorf("%w: certificate has no webp image (overlay templates are not stored as WebP)", ErrImageNotAvailable)
+		}
+		return "", fmt.Errorf("%w: certificate has no %s image", ErrImageNotAvailable, variant)
+	}
+
+	if expiry <= 0 {
+		expiry = s.options.DownloadURLExpiry
+	}
+	return s.storage.SignedURL(path, expiry)
+}
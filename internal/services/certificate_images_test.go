@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"certificate-service/internal/models"
+	"certificate-service/pkg/pdf"
+)
+
+func TestImageURL(t *testing.T) {
+	local := newTestLocalStorage(t)
+	s := &CertificateService{
+		storage: local,
+		options: Options{ImageFormats: []pdf.ImageFormat{pdf.ImagePNG, pdf.ImageWebP}},
+	}
+
+	certificate := &models.Certificate{FilePath: "event/ada.pdf"}
+	// The JPEG was stored before jpeg was turned off; no WebP was stored,
+	// as for overlay templates.
+	for _, variant := range []string{"png", "jpeg"} {
+		if err := local.Put(imagePath(certificate.FilePath, variant), []byte("image")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		variant string
+		wantErr error
+	}{
+		{variant: "png"},
+		{variant: "jpeg"},
+		{variant: "webp", wantErr: ErrImageNotAvailable},
+		{variant: ImageThumbnail, wantErr: ErrImageNotEnabled},
+		{variant: "gif", wantErr: ErrImageNotAvailable},
+	}
+	for _, tt := range tests {
+		url, err := s.ImageURL(certificate, tt.variant, 0)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ImageURL(%q) = %q, %v; want %v", tt.variant, url, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || url == "" {
+			t.Errorf("ImageURL(%q) = %q, %v; want a link", tt.variant, url, err)
+		}
+	}
+
+	s.options.ImageFormats = nil
+	if _, err := s.ImageURL(certificate, "webp", 0); !errors.Is(err, ErrImageNotEnabled) {
+		t.Errorf("ImageURL of a format turned off = %v, want ErrImageNotEnabled", err)
+	}
+}
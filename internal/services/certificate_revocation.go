@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"certificate-service/internal/models"
+	"certificate-service/internal/queue"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCertificateNotFound = errors.New("certificate not found")
+	ErrInvalidState        = errors.New("invalid certificate state")
+)
+
+func (s *CertificateService) RevokeCertificate(id uint, reason string) (*models.Certificate, error) {
+	var certificate models.Certificate
+	batchDone := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockCertificate(tx, id, &certificate); err != nil {
+			return err
+		}
+
+		switch certificate.Status {
+		case "revoked":
+			return fmt.Errorf("%w: certificate is already revoked", ErrInvalidState)
+		case "superseded":
+			return fmt.Errorf("%w: certificate has been superseded by certificate %d", ErrInvalidState, derefUint(certificate.SupersededByID))
+		}
+
+		previousStatus := certificate.Status
+		now := time.Now()
+		certificate.Status = "revoked"
+		certificate.RevokedAt = &now
+		certificate.RevocationReason = reason
+
+		if err := tx.Model(&certificate).Updates(map[string]interface{}{
+			"status":            certificate.Status,
+			"revoked_at":        certificate.RevokedAt,
+			"revocation_reason": certificate.RevocationReason,
+			"dedup_key":         nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		batchDone, err = applyBatchTransition(tx, certificate.BatchID, previousStatus, certificate.Status)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if batchDone {
+		s.batchCompleted(*certificate.BatchID)
+	}
+
+	return &certificate, nil
+}
+
+// ReissueCertificate creates a corrected successor for a certificate and
+// marks the original as superseded. The successor goes through the normal
+// generation queue; when SendEmail is set the recipient is told that it
+// replaces the earlier certificate.
+func (s *CertificateService) ReissueCertificate(ctx context.Context, id uint, req models.ReissueCertificateRequest) (*models.Certificate, error) {
+	return s.reissue(ctx, id, req, nil)
+}
+
+func (s *CertificateService) reissue(ctx context.Context, id uint, req models.ReissueCertificateRequest, idempotencyKey *string) (*models.Certificate, error) {
+	var successor models.Certificate
+	var job queue.Job
+	var completedBatch *uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var original models.Certificate
+		if err := lockCertificate(tx, id, &original); err != nil {
+			return err
+		}
+		if original.Status == "superseded" {
+			return fmt.Errorf("%w: certificate has already been reissued as certificate %d", ErrInvalidState, derefUint(original.SupersededByID))
+		}
+
+		templateID := original.TemplateID
+		if req.TemplateID != nil {
+			templateID = *req.TemplateID
+		}
+
+		var template models.Template
+		if err := tx.Where("id = ? AND is_active = ?", templateID, true).First(&template).Error; err != nil {
+			return fmt.Errorf("template not found: %w", err)
+		}
+
+		var recipient models.Recipient
+		if req.Recipient != nil {
+			recipient = newRecipient(*req.Recipient)
+			if err := tx.Create(&recipient).Error; err != nil {
+				return fmt.Errorf("failed to create recipient: %w", err)
+			}
+		} else if err := tx.First(&recipient, original.RecipientID).Error; err != nil {
+			return fmt.Errorf("failed to load recipient: %w", err)
+		}
+
+		// The original gives up its dedup key before the successor takes it.
+		previousStatus := original.Status
+		now := time.Now()
+		updates := map[string]interface{}{
+			"status":    "superseded",
+			"dedup_key": nil,
+		}
+		if original.RevokedAt == nil {
+			updates["revoked_at"] = &now
+			updates["revocation_reason"] = req.Reason
+		}
+		if err := tx.Model(&original).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		key := dedupKey(template.ID, recipient.Email, recipient.Event)
+		existing, err := findActiveCertificate(tx, key)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return fmt.Errorf("%w: certificate %d already exists for this recipient, template and event", ErrInvalidState, existing.ID)
+		}
+
+		successor = models.Certificate{
+			TemplateID:      template.ID,
+			TemplateVersion: template.Version,
+			RecipientID:     recipient.ID,
+			Status:          "pending",
+			ReplacesID:      &original.ID,
+			DedupKey:        &key,
+			IdempotencyKey:  idempotencyKey,
+		}
+		if err := tx.Create(&successor).Error; err != nil {
+			return fmt.Errorf("failed to create certificate: %w", err)
+		}
+
+		if err := tx.Model(&original).Update("superseded_by_id", successor.ID).Error; err != nil {
+			return err
+		}
+
+		job = queue.Job{
+			ID:        fmt.Sprintf("cert-%d", successor.ID),
+			Type:      "generate_certificate",
+			CreatedAt: time.Now(),
+			Data: map[string]interface{}{
+				"certificate_id":    successor.ID,
+				"send_email":        req.SendEmail,
+				"email_template_id": req.EmailTemplateID,
+			},
+		}
+		if err := addOutboxJob(tx, job, nil); err != nil {
+			return err
+		}
+
+		batchDone, err := applyBatchTransition(tx, original.BatchID, previousStatus, "superseded")
+		if batchDone {
+			completedBatch = original.BatchID
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if completedBatch != nil {
+		s.batchCompleted(*completedBatch)
+	}
+
+	s.dispatchAfterCommit(ctx, job.ID)
+
+	return &successor, nil
+}
+
+func lockCertificate(tx *gorm.DB, id uint, certificate *models.Certificate) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(certificate, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCertificateNotFound
+	}
+	return err
+}
+
+func newRecipient(data models.RecipientData) models.Recipient {
+	recipient := models.Recipient{
+		Name:      data.Name,
+		Email:     data.Email,
+		Course:    data.Course,
+		Event:     data.Event,
+		Club:      data.Club,
+		Date:      data.Date,
+		StudentID: data.StudentID,
+	}
+
+	if data.Metadata != nil {
+		metadataJSON, err := json.Marshal(data.Metadata)
+		if err == nil {
+			recipient.Metadata = metadataJSON
+		}
+	}
+
+	return recipient
+}
+
+func derefUint(v *uint) uint {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"certificate-service/internal/models"
+)
+
+func TestRevokedCertificatesLeaveBatchCounters(t *testing.T) {
+	db := openTestDB(t)
+	s := &CertificateService{db: db, queue: newUnreachableQueue(t)}
+
+	template := models.Template{Name: "revocation", Config: "{}", IsActive: true}
+	if err := db.Create(&template).Error; err != nil {
+		t.Fatal(err)
+	}
+	batch := models.CertificateBatch{TemplateID: template.ID, TotalCount: 4, Status: "processing"}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]uint, batch.TotalCount)
+	for i := range ids {
+		recipient := models.Recipient{Name: "Ada Lovelace", Email: "ada@example.com", Event: string(rune('a' + i))}
+		if err := db.Create(&recipient).Error; err != nil {
+			t.Fatal(err)
+		}
+		certificate := models.Certificate{TemplateID: template.ID, RecipientID: recipient.ID, BatchID: &batch.ID, Status: "pending"}
+		if err := db.Create(&certificate).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = certificate.ID
+	}
+
+	// One certificate completes and is then revoked, one fails and is
+	// reissued, one is revoked before it is generated and one completes.
+	steps := []func() error{
+		func() error { return complete(s, ids[0], batch.ID) },
+		func() error { _, err := s.RevokeCertificate(ids[0], "typo"); return err },
+		func() error { return fail(s, ids[1], batch.ID) },
+		func() error {
+			_, err := s.ReissueCertificate(context.Background(), ids[1], models.ReissueCertificateRequest{Reason: "wrong name"})
+			return err
+		},
+		func() error { _, err := s.RevokeCertificate(ids[2], "withdrawn"); return err },
+		func() error { return complete(s, ids[3], batch.ID) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+
+	if err := db.First(&batch, batch.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if batch.Processed != 1 || batch.Failed != 0 || batch.Revoked != 3 {
+		t.Errorf("processed %d, failed %d, revoked %d; want 1, 0, 3", batch.Processed, batch.Failed, batch.Revoked)
+	}
+	if batch.Status != "completed" || batch.CompletedAt == nil {
+		t.Errorf("batch status %q, completed_at %v; want completed with a time", batch.Status, batch.CompletedAt)
+	}
+}
+
+func TestBatchOfFailedAndRevokedCertificatesFails(t *testing.T) {
+	db := openTestDB(t)
+	s := &CertificateService{db: db}
+
+	template := models.Template{Name: "revocation", Config: "{}", IsActive: true}
+	if err := db.Create(&template).Error; err != nil {
+		t.Fatal(err)
+	}
+	recipient := models.Recipient{Name: "Ada Lovelace", Email: "ada@example.com"}
+	if err := db.Create(&recipient).Error; err != nil {
+		t.Fatal(err)
+	}
+	batch := models.CertificateBatch{TemplateID: template.ID, TotalCount: 2, Status: "processing"}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]uint, batch.TotalCount)
+	for i := range ids {
+		certificate := models.Certificate{TemplateID: template.ID, RecipientID: recipient.ID, BatchID: &batch.ID, Status: "pending"}
+		if err := db.Create(&certificate).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = certificate.ID
+	}
+
+	if _, err := s.RevokeCertificate(ids[0], "withdrawn"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fail(s, ids[1], batch.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.First(&batch, batch.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if batch.Status != "failed" || batch.Failed != 1 || batch.Revoked != 1 {
+		t.Errorf("batch %q with failed %d, revoked %d; want failed with 1, 1", batch.Status, batch.Failed, batch.Revoked)
+	}
+}
+
+func TestReissueCertificateWritesJobToOutbox(t *testing.T) {
+	db := openTestDB(t)
+	s := &CertificateService{db: db, queue: newUnreachableQueue(t)}
+
+	template := models.Template{Name: "reissue", Config: "{}", IsActive: true}
+	if err := db.Create(&template).Error; err != nil {
+		t.Fatal(err)
+	}
+	recipient := models.Recipient{Name: "Ada Lovelace", Email: "ada@example.com"}
+	if err := db.Create(&recipient).Error; err != nil {
+		t.Fatal(err)
+	}
+	original := models.Certificate{TemplateID: template.ID, RecipientID: recipient.ID, Status: "completed"}
+	if err := db.Create(&original).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	successor, err := s.ReissueCertificate(context.Background(), original.ID, models.ReissueCertificateRequest{Reason: "wrong name"})
+	if err != nil {
+		t.Fatalf("ReissueCertificate with Redis down: %v", err)
+	}
+
+	var rows []models.OutboxJob
+	if err := db.Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].JobID != fmt.Sprintf("cert-%d", successor.ID) {
+		t.Errorf("outbox holds %+v, want the job for certificate %d", rows, successor.ID)
+	}
+}
+
+func complete(s *CertificateService, id, batchID uint) error {
+	_, err := s.transitionCertificate(id, &batchID, []string{"pending", "failed"}, "completed", nil)
+	return err
+}
+
+func fail(s *CertificateService, id, batchID uint) error {
+	_, err := s.transitionCertificate(id, &batchID, []string{"pending"}, "failed", nil)
+	return err
+}
@@ -3,7 +3,11 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"certificate-service/internal/models"
@@ -14,234 +18,428 @@ import (
 
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CertificateService struct {
 	db           *gorm.DB
-	pdfGen       *pdf.HTMLGenerator
+	pdfGen       pdf.Renderer
 	emailService *email.Service
 	storage      storage.Storage
 	queue        *queue.Worker
+	jobs         *JobTracker
+	options      Options
+}
+
+// bulkInsertSize keeps multi-row inserts well under Postgres' bind
+// parameter limit.
+const bulkInsertSize = 500
+
+// defaultTemplateName is rendered when a template config names none.
+const defaultTemplateName = "certificate.html"
+
+type Options struct {
+	// PublicURL is the externally reachable base URL of this service, used to
+	// build verification links.
+	PublicURL string
+
+	// DownloadURLExpiry is how long links handed out by the API and sent
+	// in certificate emails stay valid.
+	DownloadURLExpiry time.Duration
+
+	// ImageFormats are stored next to every certificate PDF, rendered at
+	// ImageDPI. ThumbnailWidth, if set, also stores a JPEG thumbnail that
+	// many pixels wide. ImageQuality applies to JPEG and WebP images.
+	ImageFormats   []pdf.ImageFormat
+	ImageDPI       int
+	ImageQuality   int
+	ThumbnailWidth int
 }
 
 func NewCertificateService(
 	db *gorm.DB,
-	pdfGen *pdf.HTMLGenerator,
+	pdfGen pdf.Renderer,
 	emailService *email.Service,
 	storage storage.Storage,
 	queue *queue.Worker,
+	options Options,
 ) *CertificateService {
+	if options.DownloadURLExpiry <= 0 {
+		options.DownloadURLExpiry = 7 * 24 * time.Hour
+	}
+
 	service := &CertificateService{
 		db:           db,
 		pdfGen:       pdfGen,
 		emailService: emailService,
 		storage:      storage,
 		queue:        queue,
+		jobs:         NewJobTracker(db),
+		options:      options,
 	}
 
 	queue.RegisterProcessor("generate_certificate", service.processCertificateJob)
 	queue.RegisterProcessor("send_email", service.processEmailJob)
+	queue.RegisterDeadLetterHandler("generate_certificate", service.handleDeadCertificateJob)
 
 	return service
 }
 
-func (s *CertificateService) GenerateCertificate(ctx context.Context, req models.GenerateCertificateRequest) (*models.Certificate, error) {
+// GenerateCertificate issues a certificate, or returns the existing one if
+// the request carries a known idempotency key or repeats the template, email
+// and event of a live certificate. With Force set a matching live
+// certificate is reissued instead. The bool reports whether a new
+// certificate was created.
+func (s *CertificateService) GenerateCertificate(ctx context.Context, req models.GenerateCertificateRequest) (*models.Certificate, bool, error) {
 	var template models.Template
 	if err := s.db.Where("id = ? AND is_active = ?", req.TemplateID, true).First(&template).Error; err != nil {
-		return nil, fmt.Errorf("template not found: %w", err)
+		return nil, false, fmt.Errorf("template not found: %w", err)
 	}
 
-	recipient := models.Recipient{
-		Name:      req.Recipient.Name,
-		Email:     req.Recipient.Email,
-		Course:    req.Recipient.Course,
-		Event:     req.Recipient.Event,
-		Club:      req.Recipient.Club,
-		Date:      req.Recipient.Date,
-		StudentID: req.Recipient.StudentID,
+	key := dedupKey(template.ID, req.Recipient.Email, req.Recipient.Event)
+
+	existing, err := s.findExistingCertificate(req.IdempotencyKey, key)
+	if err != nil {
+		return nil, false, err
 	}
+	if existing != nil {
+		if !req.Force || (existing.IdempotencyKey != nil && *existing.IdempotencyKey == req.IdempotencyKey) {
+			return existing, false, nil
+		}
 
-	if req.Recipient.Metadata != nil {
-		metadataJSON, err := json.Marshal(req.Recipient.Metadata)
-		if err == nil {
-			recipient.Metadata = metadataJSON
+		successor, err := s.reissue(ctx, existing.ID, models.ReissueCertificateRequest{
+			Reason:          "regenerated",
+			Recipient:       &req.Recipient,
+			TemplateID:      &template.ID,
+			SendEmail:       req.SendEmail,
+			EmailTemplateID: req.EmailTemplateID,
+		}, optionalString(req.IdempotencyKey))
+		if err != nil {
+			return nil, false, err
 		}
+		return successor, true, nil
 	}
 
-	if err := s.db.Create(&recipient).Error; err != nil {
-		return nil, fmt.Errorf("failed to create recipient: %w", err)
-	}
+	var certificate models.Certificate
+	var job queue.Job
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		recipient := newRecipient(req.Recipient)
+		if err := tx.Create(&recipient).Error; err != nil {
+			return fmt.Errorf("failed to create recipient: %w", err)
+		}
 
-	certificate := models.Certificate{
-		TemplateID:  template.ID,
-		RecipientID: recipient.ID,
-		Status:      "pending",
-	}
+		certificate = models.Certificate{
+			TemplateID:      template.ID,
+			TemplateVersion: template.Version,
+			RecipientID:     recipient.ID,
+			Status:          "pending",
+			DedupKey:        &key,
+			IdempotencyKey:  optionalString(req.IdempotencyKey),
+		}
+		if err := tx.Create(&certificate).Error; err != nil {
+			return fmt.Errorf("failed to create certificate: %w", err)
+		}
 
-	if err := s.db.Create(&certificate).Error; err != nil {
-		return nil, fmt.Errorf("failed to create certificate: %w", err)
+		job = queue.Job{
+			ID:        fmt.Sprintf("cert-%d", certificate.ID),
+			Type:      "generate_certificate",
+			CreatedAt: time.Now(),
+			Data: map[string]interface{}{
+				"certificate_id":    certificate.ID,
+				"send_email":        req.SendEmail,
+				"email_template_id": req.EmailTemplateID,
+			},
+		}
+		return addOutboxJob(tx, job, nil)
+	})
+	if err != nil {
+		// A concurrent identical request may have won the unique index.
+		if existing, lookupErr := s.findExistingCertificate(req.IdempotencyKey, key); lookupErr == nil && existing != nil {
+			return existing, false, nil
+		}
+		return nil, false, err
 	}
 
-	job := queue.Job{
-		ID:        fmt.Sprintf("cert-%d", certificate.ID),
-		Type:      "generate_certificate",
-		CreatedAt: time.Now(),
-		Data: map[string]interface{}{
-			"certificate_id":    certificate.ID,
-			"send_email":        req.SendEmail,
-			"email_template_id": req.EmailTemplateID,
-		},
-	}
+	s.dispatchAfterCommit(ctx, job.ID)
+
+	return &certificate, true, nil
+}
 
-	if err := s.queue.Enqueue(ctx, job); err != nil {
-		return nil, fmt.Errorf("failed to enqueue job: %w", err)
+// findExistingCertificate looks a request up by idempotency key first and
+// then by dedup key.
+func (s *CertificateService) findExistingCertificate(idempotencyKey, key string) (*models.Certificate, error) {
+	if idempotencyKey != "" {
+		existing, err := findCertificateByIdempotencyKey(s.db, idempotencyKey)
+		if err != nil || existing != nil {
+			return existing, err
+		}
 	}
+	return findActiveCertificate(s.db, key)
+}
 
-	return &certificate, nil
+// BulkResult is the outcome of BulkGenerate.
+type BulkResult struct {
+	Batch *models.CertificateBatch
+	// Skipped lists rows matching a live certificate that were not issued
+	// again.
+	Skipped []models.SkippedRecipient
+	// Existing is set when the idempotency key matched an earlier batch,
+	// which is returned unchanged.
+	Existing bool
 }
 
-func (s *CertificateService) BulkGenerate(ctx context.Context, req models.BulkGenerateRequest) (*models.CertificateBatch, error) {
-	var template models.Template
-	if err := s.db.Where("id = ? AND is_active = ?", req.TemplateID, true).First(&template).Error; err != nil {
-		return nil, fmt.Errorf("template not found: %w", err)
+// BulkGenerate creates a batch and all of its certificates in one
+// transaction, or nothing at all if any row is invalid or an insert fails.
+// The generation jobs are written to the outbox in the same transaction and
+// enqueued after commit. Rows that match a live certificate are skipped, or
+// with Force reissued as part of the new batch. TemplateRules choose each
+// recipient's template; the batch's TemplateID is the fallback.
+func (s *CertificateService) BulkGenerate(ctx context.Context, req models.BulkGenerateRequest) (*BulkResult, error) {
+	return s.bulkGenerate(ctx, req, nil)
+}
+
+// bulkGenerate is BulkGenerate with the row numbers to report for each
+// recipient; nil numbers rows from 1.
+func (s *CertificateService) bulkGenerate(ctx context.Context, req models.BulkGenerateRequest, rows []int) (*BulkResult, error) {
+	templates, err := s.loadBatchTemplates(req.TemplateID, req.TemplateRules)
+	if err != nil {
+		return nil, err
 	}
 
-	batch := models.CertificateBatch{
-		TemplateID: template.ID,
-		TotalCount: len(req.Recipients),
-		Status:     "processing",
+	if rowErrors := validateRecipients(req.Recipients, rows); len(rowErrors) > 0 {
+		return nil, &ValidationError{Rows: rowErrors}
 	}
 
-	if err := s.db.Create(&batch).Error; err != nil {
-		return nil, fmt.Errorf("failed to create batch: %w", err)
+	if req.IdempotencyKey != "" {
+		existing, err := findBatchByIdempotencyKey(s.db, req.IdempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return &BulkResult{Batch: existing, Existing: true}, nil
+		}
 	}
 
-	var jobs []queue.Job
+	templateIDs := make([]uint, len(req.Recipients))
+	keys := make([]string, len(req.Recipients))
 	for i, recipientData := range req.Recipients {
-		recipient := models.Recipient{
-			Name:      recipientData.Name,
-			Email:     recipientData.Email,
-			Course:    recipientData.Course,
-			Event:     recipientData.Event,
-			Club:      recipientData.Club,
-			Date:      recipientData.Date,
-			StudentID: recipientData.StudentID,
-		}
-
-		if recipientData.Metadata != nil {
-			metadataJSON, err := json.Marshal(recipientData.Metadata)
-			if err == nil {
-				recipient.Metadata = metadataJSON
+		templateIDs[i] = selectTemplate(req.TemplateRules, recipientData, req.TemplateID)
+		keys[i] = dedupKey(templateIDs[i], recipientData.Email, recipientData.Event)
+	}
+
+	var batchMetadata datatypes.JSON
+	if len(req.TemplateRules) > 0 {
+		metadata, err := json.Marshal(map[string]interface{}{"template_rules": req.TemplateRules})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode template rules: %w", err)
+		}
+		batchMetadata = metadata
+	}
+
+	result := &BulkResult{}
+	var completedBatches []uint
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		lookup := tx
+		if req.Force {
+			lookup = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		existing, err := findActiveCertificates(lookup, keys)
+		if err != nil {
+			return err
+		}
+
+		var issue []int
+		for i, key := range keys {
+			certificate, ok := existing[key]
+			if !ok || req.Force {
+				issue = append(issue, i)
+				continue
 			}
+
+			row := i + 1
+			if rows != nil {
+				row = rows[i]
+			}
+			result.Skipped = append(result.Skipped, models.SkippedRecipient{
+				Row:           row,
+				CertificateID: certificate.ID,
+				Code:          certificate.Code,
+				Status:        certificate.Status,
+			})
 		}
 
-		if err := s.db.Create(&recipient).Error; err != nil {
-			continue
+		// Forced rows take over the dedup key of the certificate they
+		// replace, which has to give it up first.
+		now := time.Now()
+		for _, i := range issue {
+			original, ok := existing[keys[i]]
+			if !ok {
+				continue
+			}
+
+			updates := map[string]interface{}{
+				"status":    "superseded",
+				"dedup_key": nil,
+			}
+			if original.RevokedAt == nil {
+				updates["revoked_at"] = &now
+				updates["revocation_reason"] = "regenerated"
+			}
+			if err := tx.Model(&models.Certificate{}).Where("id = ?", original.ID).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to supersede certificate %d: %w", original.ID, err)
+			}
+
+			batchDone, err := applyBatchTransition(tx, original.BatchID, original.Status, "superseded")
+			if err != nil {
+				return err
+			}
+			if batchDone {
+				completedBatches = append(completedBatches, *original.BatchID)
+			}
 		}
 
-		certificate := models.Certificate{
-			TemplateID:  template.ID,
-			RecipientID: recipient.ID,
-			Status:      "pending",
+		batch := models.CertificateBatch{
+			TemplateID:     req.TemplateID,
+			TotalCount:     len(issue),
+			Status:         "processing",
+			IdempotencyKey: optionalString(req.IdempotencyKey),
+			Metadata:       batchMetadata,
+		}
+		if len(issue) == 0 {
+			batch.Status = "completed"
+			batch.CompletedAt = &now
 		}
+		if err := tx.Create(&batch).Error; err != nil {
+			return fmt.Errorf("failed to create batch: %w", err)
+		}
+		result.Batch = &batch
 
-		if err := s.db.Create(&certificate).Error; err != nil {
-			continue
+		if len(issue) == 0 {
+			return nil
 		}
 
-		job := queue.Job{
-			ID:        fmt.Sprintf("cert-%d-%d", batch.ID, i),
-			Type:      "generate_certificate",
-			CreatedAt: time.Now(),
-			Data: map[string]interface{}{
-				"certificate_id":    certificate.ID,
-				"batch_id":          batch.ID,
-				"send_email":        req.SendEmail,
-				"email_template_id": req.EmailTemplateID,
-			},
+		recipients := make([]models.Recipient, len(issue))
+		for n, i := range issue {
+			recipients[n] = newRecipient(req.Recipients[i])
+		}
+		if err := tx.CreateInBatches(&recipients, bulkInsertSize).Error; err != nil {
+			return fmt.Errorf("failed to create recipients: %w", err)
 		}
 
-		jobs = append(jobs, job)
+		certificates := make([]models.Certificate, len(issue))
+		for n, i := range issue {
+			certificates[n] = models.Certificate{
+				TemplateID:      templateIDs[i],
+				TemplateVersion: templates[templateIDs[i]].Version,
+				RecipientID:     recipients[n].ID,
+				BatchID:         &batch.ID,
+				Status:          "pending",
+				DedupKey:        &keys[i],
+			}
+			if original, ok := existing[keys[i]]; ok {
+				certificates[n].ReplacesID = &original.ID
+			}
+		}
+		if err := tx.CreateInBatches(&certificates, bulkInsertSize).Error; err != nil {
+			return fmt.Errorf("failed to create certificates: %w", err)
+		}
+
+		for _, certificate := range certificates {
+			if certificate.ReplacesID == nil {
+				continue
+			}
+			if err := tx.Model(&models.Certificate{}).Where("id = ?", *certificate.ReplacesID).Update("superseded_by_id", certificate.ID).Error; err != nil {
+				return fmt.Errorf("failed to link certificate %d: %w", *certificate.ReplacesID, err)
+			}
+		}
+
+		outbox := make([]models.OutboxJob, len(certificates))
+		for n, certificate := range certificates {
+			job := queue.Job{
+				ID:        fmt.Sprintf("cert-%d-%d", batch.ID, n),
+				Type:      "generate_certificate",
+				CreatedAt: time.Now(),
+				Data: map[string]interface{}{
+					"certificate_id":    certificate.ID,
+					"batch_id":          batch.ID,
+					"send_email":        req.SendEmail,
+					"email_template_id": req.EmailTemplateID,
+				},
+			}
+
+			row, err := newOutboxJob(job, &batch.ID)
+			if err != nil {
+				return err
+			}
+			outbox[n] = row
+		}
+		if err := tx.CreateInBatches(&outbox, bulkInsertSize).Error; err != nil {
+			return fmt.Errorf("failed to write outbox: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		// A concurrent request with the same idempotency key may have won.
+		if req.IdempotencyKey != "" {
+			if existing, lookupErr := findBatchByIdempotencyKey(s.db, req.IdempotencyKey); lookupErr == nil && existing != nil {
+				return &BulkResult{Batch: existing, Existing: true}, nil
+			}
+		}
+		return nil, err
 	}
 
-	if err := s.queue.EnqueueBatch(ctx, jobs); err != nil {
-		return nil, fmt.Errorf("failed to enqueue batch: %w", err)
+	for _, batchID := range completedBatches {
+		s.batchCompleted(batchID)
 	}
 
-	return &batch, nil
+	// The batch is committed either way; anything not dispatched here is
+	// picked up by the outbox relay.
+	if _, err := s.dispatchOutbox(context.WithoutCancel(ctx), &result.Batch.ID); err != nil {
+		log.Printf("Batch %d: deferring enqueue to outbox relay: %v", result.Batch.ID, err)
+	}
+
+	return result, nil
 }
 
 func (s *CertificateService) processCertificateJob(ctx context.Context, job queue.Job) error {
-	var certID uint
-	switch v := job.Data["certificate_id"].(type) {
-	case float64:
-		certID = uint(v)
-	case int:
-		certID = uint(v)
-	case uint:
-		certID = v
-	default:
-		return fmt.Errorf("invalid certificate_id in job data: %v", job.Data["certificate_id"])
+	certID, ok := jobUint(job.Data["certificate_id"])
+	if !ok {
+		return queue.Permanent(fmt.Errorf("invalid certificate_id in job data: %v", job.Data["certificate_id"]))
 	}
 
 	var certificate models.Certificate
 	if err := s.db.Preload("Template").Preload("Recipient").First(&certificate, certID).Error; err != nil {
-		return fmt.Errorf("certificate not found: %w", err)
+		return queue.Permanent(fmt.Errorf("certificate not found: %w", err))
 	}
 
-	var templateConfig map[string]interface{}
-	if certificate.Template.Config != "" {
-		json.Unmarshal([]byte(certificate.Template.Config), &templateConfig)
+	// Revoked or reissued before the job got to run; nothing to render.
+	if certificate.Status == "revoked" || certificate.Status == "superseded" {
+		return nil
 	}
 
-	templateName := "certificate.html"
-	if name, ok := templateConfig["template_name"].(string); ok && name != "" {
-		templateName = name
+	template, err := templateAtVersion(s.db, certificate.Template, certificate.TemplateVersion)
+	if err != nil {
+		return queue.Permanent(err)
 	}
 
-	data := map[string]string{
-		"name":          certificate.Recipient.Name,
-		"email":         certificate.Recipient.Email,
-		"course":        certificate.Recipient.Course,
-		"event":         certificate.Recipient.Event,
-		"club":          certificate.Recipient.Club,
-		"date":          certificate.Recipient.Date,
-		"student_id":    certificate.Recipient.StudentID,
-		"signer1_name":  getStringFromMetadata(certificate.Recipient.Metadata, "signer1_name", ""),
-		"signer1_title": getStringFromMetadata(certificate.Recipient.Metadata, "signer1_title", "Event Coordinator"),
-		"signer2_name":  getStringFromMetadata(certificate.Recipient.Metadata, "signer2_name", ""),
-		"signer2_title": getStringFromMetadata(certificate.Recipient.Metadata, "signer2_title", "Head Of Department\n(CSE)"),
-		"signer3_name":  getStringFromMetadata(certificate.Recipient.Metadata, "signer3_name", ""),
-		"signer3_title": getStringFromMetadata(certificate.Recipient.Metadata, "signer3_title", "Director,\nBhimtal Campus"),
-	}
+	templateName, data := renderData(template, certificate.Recipient, certificate.Code, s.VerifyURL(&certificate))
 
-	if sideDesign, ok := templateConfig["side_design"].(string); ok {
-		data["side_design"] = sideDesign
-	}
-	if orgLogo, ok := templateConfig["org_logo"].(string); ok {
-		data["org_logo"] = orgLogo
-	}
-	if clubLogo, ok := templateConfig["club_logo"].(string); ok {
-		data["club_logo"] = clubLogo
-	}
-	if sig1, ok := templateConfig["signature1"].(string); ok {
-		data["signature1"] = sig1
-	}
-	if sig2, ok := templateConfig["signature2"].(string); ok {
-		data["signature2"] = sig2
-	}
-	if sig3, ok := templateConfig["signature3"].(string); ok {
-		data["signature3"] = sig3
+	pdfData, err := s.pdfGen.GenerateWithTemplate(ctx, templateName, data)
+	if errors.Is(err, pdf.ErrInvalidTemplate) || errors.Is(err, pdf.ErrRendererUnavailable) {
+		return queue.Permanent(fmt.Errorf("failed to generate PDF: %w", err))
 	}
-	if sig4, ok := templateConfig["signature4"].(string); ok {
-		data["signature4"] = sig4
+	if err != nil {
+		return fmt.Errorf("failed to generate PDF: %w", err)
 	}
 
-	pdfData, err := s.pdfGen.GenerateWithTemplate(templateName, data)
+	images, err := s.renderImages(ctx, templateName, data)
+	if errors.Is(err, pdf.ErrInvalidTemplate) || errors.Is(err, pdf.ErrRendererUnavailable) {
+		return queue.Permanent(fmt.Errorf("failed to generate images: %w", err))
+	}
 	if err != nil {
-		s.db.Model(&certificate).Update("status", "failed")
-		s.updateBatchOnFailure(job)
-		return fmt.Errorf("failed to generate PDF: %w", err)
+		return fmt.Errorf("failed to generate images: %w", err)
 	}
 
 	eventName := certificate.Recipient.Event
@@ -250,21 +448,24 @@ func (s *CertificateService) processCertificateJob(ctx context.Context, job queu
 	}
 
 	filePath, err := s.storage.Save(pdfData, eventName, certificate.Recipient.Name, certificate.Recipient.Email)
+	if errors.Is(err, storage.ErrInvalidPath) {
+		// The recipient's name or email cannot be stored; retrying will not
+		// change that.
+		return queue.Permanent(fmt.Errorf("failed to save certificate: %w", err))
+	}
 	if err != nil {
-		s.db.Model(&certificate).Update("status", "failed")
-		s.updateBatchOnFailure(job)
 		return fmt.Errorf("failed to save certificate: %w", err)
 	}
-
-	certificate.Status = "completed"
-	certificate.FilePath = filePath
-	if err := s.db.Save(&certificate).Error; err != nil {
-		return fmt.Errorf("failed to update certificate: %w", err)
+	if err := s.saveImages(filePath, images); err != nil {
+		s.deleteFiles(filePath, images)
+		return err
 	}
 
-	sendEmail, _ := job.Data["send_email"].(bool)
-	if sendEmail {
-		emailJob := queue.Job{
+	// The email job goes through the outbox with the status change, so it
+	// is not lost if Redis is unavailable once the certificate is completed.
+	var followUp []queue.Job
+	if sendEmail, _ := job.Data["send_email"].(bool); sendEmail {
+		followUp = append(followUp, queue.Job{
 			ID:        fmt.Sprintf("email-%d", certificate.ID),
 			Type:      "send_email",
 			CreatedAt: time.Now(),
@@ -272,89 +473,57 @@ func (s *CertificateService) processCertificateJob(ctx context.Context, job queu
 				"certificate_id":    certificate.ID,
 				"email_template_id": job.Data["email_template_id"],
 			},
-		}
-		s.queue.Enqueue(ctx, emailJob)
+		})
 	}
 
-	s.updateBatchOnSuccess(job)
-
-	return nil
-}
-
-func (s *CertificateService) updateBatchOnSuccess(job queue.Job) {
-	var batchID uint
-	switch v := job.Data["batch_id"].(type) {
-	case float64:
-		batchID = uint(v)
-	case int:
-		batchID = uint(v)
-	case uint:
-		batchID = v
-	default:
-		return
+	issuedAt := time.Now()
+	changed, err := s.transitionCertificate(certificate.ID, jobDataUint(job, "batch_id"), []string{"pending", "failed"}, "completed", map[string]interface{}{
+		"file_path": filePath,
+		"issued_at": issuedAt,
+	}, followUp...)
+	if err != nil {
+		s.deleteFiles(filePath, images)
+		return fmt.Errorf("failed to update certificate: %w", err)
 	}
-
-	if batchID == 0 {
-		return
+	if !changed {
+		// Another delivery of this job got there first, or the certificate
+		// was revoked while rendering; keep the earlier outcome.
+		s.deleteFiles(filePath, images)
+		return nil
 	}
 
-	var batch models.CertificateBatch
-	if err := s.db.First(&batch, batchID).Error; err == nil {
-		batch.Processed++
-		if batch.Processed+batch.Failed >= batch.TotalCount {
-			batch.Status = "completed"
-		}
-		s.db.Save(&batch)
+	for _, next := range followUp {
+		s.dispatchAfterCommit(ctx, next.ID)
 	}
-}
 
-func (s *CertificateService) updateBatchOnFailure(job queue.Job) {
-	var batchID uint
-	switch v := job.Data["batch_id"].(type) {
-	case float64:
-		batchID = uint(v)
-	case int:
-		batchID = uint(v)
-	case uint:
-		batchID = v
-	default:
-		return
-	}
+	return nil
+}
 
-	if batchID == 0 {
+// handleDeadCertificateJob runs once generation has given up on a
+// certificate, so the failure is only counted against its batch once.
+func (s *CertificateService) handleDeadCertificateJob(ctx context.Context, job queue.Job, jobErr error) {
+	certID, ok := jobUint(job.Data["certificate_id"])
+	if !ok {
 		return
 	}
-
-	var batch models.CertificateBatch
-	if err := s.db.First(&batch, batchID).Error; err == nil {
-		batch.Failed++
-		if batch.Processed+batch.Failed >= batch.TotalCount {
-			if batch.Failed == batch.TotalCount {
-				batch.Status = "failed"
-			} else {
-				batch.Status = "completed"
-			}
-		}
-		s.db.Save(&batch)
+	if _, err := s.transitionCertificate(certID, jobDataUint(job, "batch_id"), []string{"pending"}, "failed", nil); err != nil {
+		log.Printf("Failed to mark certificate %d as failed: %v", certID, err)
 	}
 }
 
 func (s *CertificateService) processEmailJob(ctx context.Context, job queue.Job) error {
-	var certID uint
-	switch v := job.Data["certificate_id"].(type) {
-	case float64:
-		certID = uint(v)
-	case int:
-		certID = uint(v)
-	case uint:
-		certID = v
-	default:
-		return fmt.Errorf("invalid certificate_id in job data: %v", job.Data["certificate_id"])
+	certID, ok := jobUint(job.Data["certificate_id"])
+	if !ok {
+		return queue.Permanent(fmt.Errorf("invalid certificate_id in job data: %v", job.Data["certificate_id"]))
 	}
 
 	var certificate models.Certificate
-	if err := s.db.Preload("Recipient").First(&certificate, certID).Error; err != nil {
-		return fmt.Errorf("certificate not found: %w", err)
+	if err := s.db.Preload("Recipient").Preload("Replaces").First(&certificate, certID).Error; err != nil {
+		return queue.Permanent(fmt.Errorf("certificate not found: %w", err))
+	}
+
+	if certificate.Status != "completed" || certificate.EmailSent {
+		return nil
 	}
 
 	if certificate.FilePath == "" {
@@ -362,30 +531,22 @@ func (s *CertificateService) processEmailJob(ctx context.Context, job queue.Job)
 	}
 
 	var emailTemplate models.EmailTemplate
-	var emailTemplateID uint
-
-	if templateIDRaw, ok := job.Data["email_template_id"]; ok && templateIDRaw != nil {
-		switch v := templateIDRaw.(type) {
-		case float64:
-			emailTemplateID = uint(v)
-		case int:
-			emailTemplateID = uint(v)
-		case uint:
-			emailTemplateID = v
-		}
-	}
+	emailTemplateID, _ := jobUint(job.Data["email_template_id"])
 
 	if emailTemplateID > 0 {
 		if err := s.db.Where("id = ? AND is_active = ?", emailTemplateID, true).First(&emailTemplate).Error; err != nil {
-			return fmt.Errorf("email template not found: %w", err)
+			return queue.Permanent(fmt.Errorf("email template not found: %w", err))
 		}
 	} else {
 		if err := s.db.Where("name = ? AND is_active = ?", "default", true).First(&emailTemplate).Error; err != nil {
-			return fmt.Errorf("default email template not found: %w", err)
+			return queue.Permanent(fmt.Errorf("default email template not found: %w", err))
 		}
 	}
 
-	downloadURL := fmt.Sprintf("/api/v1/certificates/%d/download", certificate.ID)
+	downloadURL, err := s.DownloadURL(&certificate, s.options.DownloadURLExpiry)
+	if err != nil {
+		return fmt.Errorf("failed to sign download url: %w", err)
+	}
 
 	data := map[string]interface{}{
 		"name":         certificate.Recipient.Name,
@@ -395,6 +556,34 @@ func (s *CertificateService) processEmailJob(ctx context.Context, job queue.Job)
 		"club":         certificate.Recipient.Club,
 		"date":         certificate.Recipient.Date,
 		"download_url": downloadURL,
+		"code":         certificate.Code,
+		"verify_url":   s.VerifyURL(&certificate),
+		"is_reissue":   false,
+	}
+
+	if certificate.Replaces != nil {
+		data["is_reissue"] = true
+		data["previous_code"] = certificate.Replaces.Code
+		data["reissue_reason"] = certificate.Replaces.RevocationReason
+	}
+
+	// Record the send before making it, so failing to record it afterwards
+	// cannot make a retry mail the recipient twice. Only one delivery of the
+	// job can claim it; a failed send releases it for the retry.
+	now := time.Now()
+	claim := s.db.Model(&models.Certificate{}).
+		Where("id = ? AND email_sent = ?", certificate.ID, false).
+		Updates(map[string]interface{}{
+			"email_sent":             true,
+			"email_sent_at":          &now,
+			"email_template_id":      emailTemplate.ID,
+			"email_template_version": emailTemplate.Version,
+		})
+	if claim.Error != nil {
+		return fmt.Errorf("failed to update certificate: %w", claim.Error)
+	}
+	if claim.RowsAffected == 0 {
+		return nil
 	}
 
 	if err := s.emailService.SendWithTemplate(
@@ -403,17 +592,120 @@ func (s *CertificateService) processEmailJob(ctx context.Context, job queue.Job)
 		emailTemplate.BodyHTML,
 		data,
 	); err != nil {
+		if releaseErr := s.db.Model(&models.Certificate{}).Where("id = ?", certificate.ID).Updates(map[string]interface{}{
+			"email_sent":    false,
+			"email_sent_at": nil,
+		}).Error; releaseErr != nil {
+			// A retry would find the email marked sent and skip it.
+			return queue.Permanent(fmt.Errorf("failed to send email: %v (and failed to clear email_sent: %v)", err, releaseErr))
+		}
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
-	now := time.Now()
-	certificate.EmailSent = true
-	certificate.EmailSentAt = &now
-	if err := s.db.Save(&certificate).Error; err != nil {
-		return fmt.Errorf("failed to update certificate: %w", err)
+	return nil
+}
+
+// renderData builds the template name and renderer input for one
+// certificate from its template config and recipient.
+func renderData(template models.Template, recipient models.Recipient, code, verifyURL string) (string, map[string]string) {
+	var templateConfig map[string]interface{}
+	if template.Config != "" {
+		json.Unmarshal([]byte(template.Config), &templateConfig)
 	}
 
-	return nil
+	templateName := defaultTemplateName
+	if name, ok := templateConfig["template_name"].(string); ok && name != "" {
+		templateName = name
+	}
+
+	data := map[string]string{
+		"name":          recipient.Name,
+		"email":         recipient.Email,
+		"course":        recipient.Course,
+		"event":         recipient.Event,
+		"club":          recipient.Club,
+		"date":          recipient.Date,
+		"student_id":    recipient.StudentID,
+		"code":          code,
+		"verify_url":    verifyURL,
+		"signer1_name":  getStringFromMetadata(recipient.Metadata, "signer1_name", ""),
+		"signer1_title": getStringFromMetadata(recipient.Metadata, "signer1_title", "Event Coordinator"),
+		"signer2_name":  getStringFromMetadata(recipient.Metadata, "signer2_name", ""),
+		"signer2_title": getStringFromMetadata(recipient.Metadata, "signer2_title", "Head Of Department\n(CSE)"),
+		"signer3_name":  getStringFromMetadata(recipient.Metadata, "signer3_name", ""),
+		"signer3_title": getStringFromMetadata(recipient.Metadata, "signer3_title", "Director,\nBhimtal Campus"),
+	}
+
+	if sideDesign, ok := templateConfig["side_design"].(string); ok {
+		data["side_design"] = sideDesign
+	}
+	if orgLogo, ok := templateConfig["org_logo"].(string); ok {
+		data["org_logo"] = orgLogo
+	}
+	if clubLogo, ok := templateConfig["club_logo"].(string); ok {
+		data["club_logo"] = clubLogo
+	}
+	if sig1, ok := templateConfig["signature1"].(string); ok {
+		data["signature1"] = sig1
+	}
+	if sig2, ok := templateConfig["signature2"].(string); ok {
+		data["signature2"] = sig2
+	}
+	if sig3, ok := templateConfig["signature3"].(string); ok {
+		data["signature3"] = sig3
+	}
+	if sig4, ok := templateConfig["signature4"].(string); ok {
+		data["signature4"] = sig4
+	}
+	if qrSize, ok := templateConfig["qr_size"]; ok {
+		data["qr_size"] = fmt.Sprint(qrSize)
+	}
+	if qrLevel, ok := templateConfig["qr_error_correction"].(string); ok {
+		data["qr_error_correction"] = qrLevel
+	}
+	if timeout, ok := templateConfig["render_timeout"]; ok {
+		data["render_timeout"] = fmt.Sprint(timeout)
+	}
+	for _, key := range pdf.PageSettings {
+		if value, ok := templateConfig[key]; ok {
+			data[key] = metaString(value)
+		}
+	}
+
+	// Template config values are defaults for {{.Meta.x}}; recipient
+	// metadata overrides them.
+	for key, value := range templateConfig {
+		data[pdf.MetaPrefix+key] = metaString(value)
+	}
+	var metadata map[string]interface{}
+	if len(recipient.Metadata) > 0 {
+		json.Unmarshal(recipient.Metadata, &metadata)
+	}
+	for key, value := range metadata {
+		data[pdf.MetaPrefix+key] = metaString(value)
+	}
+
+	return templateName, data
+}
+
+// metaString formats a JSON value for printing in a template.
+func metaString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
 }
 
 func getStringFromMetadata(metadataJSON datatypes.JSON, key, defaultValue string) string {
@@ -443,6 +735,49 @@ func (s *CertificateService) GetCertificate(id uint) (*models.Certificate, error
 	return &certificate, nil
 }
 
+// GetCertificateByCode looks a certificate up by its verification code, so
+// its files can be served without exposing sequential IDs.
+func (s *CertificateService) GetCertificateByCode(code string) (*models.Certificate, error) {
+	code = models.NormalizeCertificateCode(code)
+	if code == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var certificate models.Certificate
+	if err := s.db.Where("code = ?", code).First(&certificate).Error; err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+func (s *CertificateService) VerifyCertificate(code string) (*models.Certificate, error) {
+	code = models.NormalizeCertificateCode(code)
+	if code == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var certificate models.Certificate
+	if err := s.db.Preload("Recipient").Preload("Replaces").Preload("SupersededBy").Where("code = ?", code).First(&certificate).Error; err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+func (s *CertificateService) VerifyURL(certificate *models.Certificate) string {
+	return fmt.Sprintf("%s/verify/%s", strings.TrimRight(s.options.PublicURL, "/"), certificate.Code)
+}
+
+// DownloadLink returns the lasting link to a certificate, addressed by its
+// code. It redirects to a short-lived signed link to the file.
+func (s *CertificateService) DownloadLink(certificate *models.Certificate) string {
+	return fmt.Sprintf("%s/download/%s", strings.TrimRight(s.options.PublicURL, "/"), certificate.Code)
+}
+
+// LastError returns the most recent job error for a certificate, if any.
+func (s *CertificateService) LastError(certificateID uint) string {
+	return s.jobs.LastCertificateError(certificateID)
+}
+
 func (s *CertificateService) GetBatchStatus(id uint) (*models.CertificateBatch, error) {
 	var batch models.CertificateBatch
 	if err := s.db.Preload("Template").First(&batch, id).Error; err != nil {
@@ -451,6 +786,18 @@ func (s *CertificateService) GetBatchStatus(id uint) (*models.CertificateBatch,
 	return &batch, nil
 }
 
+// DownloadURL returns an absolute, signed link to the certificate PDF that
+// stops working after expiry. A zero expiry uses the configured default.
+func (s *CertificateService) DownloadURL(certificate *models.Certificate, expiry time.Duration) (string, error) {
+	if certificate.FilePath == "" {
+		return "", fmt.Errorf("certificate file not generated yet")
+	}
+	if expiry <= 0 {
+		expiry = s.options.DownloadURLExpiry
+	}
+	return s.storage.SignedURL(certificate.FilePath, expiry)
+}
+
 func (s *CertificateService) GetStorage() storage.Storage {
 	return s.storage
 }
@@ -462,3 +809,20 @@ func (s *CertificateService) ProcessCertificateJob(ctx context.Context, job queu
 func (s *CertificateService) ProcessEmailJob(ctx context.Context, job queue.Job) error {
 	return s.processEmailJob(ctx, job)
 }
+
+func (s *CertificateService) HandleDeadCertificateJob(ctx context.Context, job queue.Job, err error) {
+	s.handleDeadCertificateJob(ctx, job, err)
+}
+
+func jobUint(v interface{}) (uint, bool) {
+	switch v := v.(type) {
+	case float64:
+		return uint(v), true
+	case int:
+		return uint(v), true
+	case uint:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"certificate-service/internal/models"
+	"certificate-service/internal/queue"
+	"certificate-service/internal/storage"
+	"certificate-service/pkg/pdf"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// stubRenderer renders every template as the same few bytes.
+type stubRenderer struct{}
+
+func (stubRenderer) GenerateWithTemplate(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	return []byte("%PDF-stub"), nil
+}
+
+func (stubRenderer) GenerateImages(ctx context.Context, templateName string, data map[string]string, options []pdf.ImageOptions) ([][]byte, error) {
+	return make([][]byte, len(options)), nil
+}
+
+func (stubRenderer) GeneratePreview(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	return []byte("png"), nil
+}
+
+func (stubRenderer) TemplateFields(templateName string) ([]string, error) {
+	return nil, nil
+}
+
+func (stubRenderer) ValidateTemplate(templateName string, images map[string]string) ([]pdf.TemplateProblem, error) {
+	return nil, nil
+}
+
+func (stubRenderer) Close() error {
+	return nil
+}
+
+func newTestLocalStorage(t *testing.T) *storage.LocalStorage {
+	t.Helper()
+	local, err := storage.NewLocalStorage(filepath.Join(t.TempDir(), "certificates"), "http://localhost/files", "test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return local
+}
+
+// newUnreachableQueue returns a queue whose Redis refuses every connection,
+// so enqueues fail the way they do during a Redis outage.
+func newUnreachableQueue(t *testing.T) *queue.Worker {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return queue.NewWorker(client, "certificates", "test", queue.Options{})
+}
+
+func TestProcessCertificateJobStorageRejectsName(t *testing.T) {
+	db := openTestDB(t)
+	s := &CertificateService{db: db, pdfGen: stubRenderer{}, storage: newTestLocalStorage(t)}
+
+	template := models.Template{Name: "storage", Config: "{}"}
+	if err := db.Create(&template).Error; err != nil {
+		t.Fatal(err)
+	}
+	recipient := models.Recipient{Name: "Ada/Lovelace", Email: "ada@example.com"}
+	if err := db.Create(&recipient).Error; err != nil {
+		t.Fatal(err)
+	}
+	certificate := models.Certificate{TemplateID: template.ID, RecipientID: recipient.ID, Status: "pending"}
+	if err := db.Create(&certificate).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.processCertificateJob(context.Background(), queue.Job{Data: map[string]interface{}{"certificate_id": float64(certificate.ID)}})
+	if err == nil || !queue.IsPermanent(err) {
+		t.Errorf("processCertificateJob = %v, want a permanent error", err)
+	}
+	if !errors.Is(err, storage.ErrInvalidPath) {
+		t.Errorf("processCertificateJob = %v, want ErrInvalidPath", err)
+	}
+}
+
+func TestGenerateCertificateWritesJobToOutbox(t *testing.T) {
+	db := openTestDB(t)
+	s := &CertificateService{db: db, queue: newUnreachableQueue(t)}
+
+	template := models.Template{Name: "outbox", Config: "{}", IsActive: true}
+	if err := db.Create(&template).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, created, err := s.GenerateCertificate(context.Background(), models.GenerateCertificateRequest{
+		TemplateID: template.ID,
+		Recipient:  models.RecipientData{Name: "Ada Lovelace", Email: "ada@example.com"},
+	})
+	if err != nil || !created {
+		t.Fatalf("GenerateCertificate with Redis down = %v, %v; want a new certificate", created, err)
+	}
+
+	var rows []models.OutboxJob
+	if err := db.Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].JobID != fmt.Sprintf("cert-%d", certificate.ID) {
+		t.Errorf("outbox holds %+v, want the job for certificate %d", rows, certificate.ID)
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"certificate-service/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// dedupKey is the natural identity of a certificate: one live certificate
+// per template, email address and event.
+func dedupKey(templateID uint, email, event string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s",
+		templateID,
+		strings.ToLower(strings.TrimSpace(email)),
+		strings.ToLower(strings.TrimSpace(event)),
+	)))
+	return hex.EncodeToString(sum[:])
+}
+
+// findActiveCertificate returns the live certificate holding a dedup key,
+// or nil if there is none.
+func findActiveCertificate(tx *gorm.DB, key string) (*models.Certificate, error) {
+	var certificate models.Certificate
+	err := tx.Where("dedup_key = ?", key).First(&certificate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up certificate: %w", err)
+	}
+	return &certificate, nil
+}
+
+// findActiveCertificates is findActiveCertificate for many keys at once,
+// keyed by dedup key.
+func findActiveCertificates(tx *gorm.DB, keys []string) (map[string]models.Certificate, error) {
+	found := make(map[string]models.Certificate)
+	for start := 0; start < len(keys); start += bulkInsertSize {
+		end := start + bulkInsertSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var certificates []models.Certificate
+		if err := tx.Where("dedup_key IN ?", keys[start:end]).Find(&certificates).Error; err != nil {
+			return nil, fmt.Errorf("failed to look up certificates: %w", err)
+		}
+		for _, certificate := range certificates {
+			found[*certificate.DedupKey] = certificate
+		}
+	}
+	return found, nil
+}
+
+func findCertificateByIdempotencyKey(tx *gorm.DB, key string) (*models.Certificate, error) {
+	var certificate models.Certificate
+	err := tx.Where("idempotency_key = ?", key).First(&certificate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up certificate: %w", err)
+	}
+	return &certificate, nil
+}
+
+func findBatchByIdempotencyKey(tx *gorm.DB, key string) (*models.CertificateBatch, error) {
+	var batch models.CertificateBatch
+	err := tx.Where("idempotency_key = ?", key).First(&batch).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up batch: %w", err)
+	}
+	return &batch, nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"certificate-service/internal/models"
+	"certificate-service/pkg/pdf"
+)
+
+const (
+	defaultPreviewCount = 3
+	maxPreviewCount     = 10
+
+	// previewCode stands in for the verification code in previews, since no
+	// certificate exists yet.
+	previewCode = "PREVIEW"
+)
+
+// templateFieldSources maps the certificate template fields that come from
+// recipient data to the recipient field that fills them.
+var templateFieldSources = map[string]string{
+	"Name":      "name",
+	"StudentID": "student_id",
+	"Course":    "course",
+	"Event":     "event",
+	"Club":      "club",
+	"Date":      "date",
+}
+
+// DryRunBulkGenerate checks a bulk request like BulkGenerate without
+// creating any records or jobs.
+func (s *CertificateService) DryRunBulkGenerate(ctx context.Context, req models.BulkGenerateRequest) (*models.DryRunReport, error) {
+	return s.dryRun(ctx, req.TemplateID, req.TemplateRules, req.Recipients, nil, req.Previews)
+}
+
+// dryRun validates recipients, reports template fields they leave empty and
+// renders previews. Previews cover the first valid row of each selected
+// template before further rows, so every certificate type can be checked.
+func (s *CertificateService) dryRun(ctx context.Context, templateID uint, rules []models.TemplateRule, recipients []models.RecipientData, rows []int, previews int) (*models.DryRunReport, error) {
+	templates, err := s.loadBatchTemplates(templateID, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[uint][]string, len(templates))
+	for id, template := range templates {
+		templateName, _ := renderData(template, models.Recipient{}, "", "")
+		templateFields, err := s.pdfGen.TemplateFields(templateName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %d: %w", id, err)
+		}
+		fields[id] = templateFields
+	}
+
+	report := &models.DryRunReport{
+		TotalRows: len(recipients),
+		Templates: make(map[uint]int),
+		Errors:    validateRecipients(recipients, rows),
+		Warnings:  []models.RowError{},
+		Previews:  []models.RowPreview{},
+	}
+	if report.Errors == nil {
+		report.Errors = []models.RowError{}
+	}
+	report.Valid = len(report.Errors) == 0
+
+	templateIDs := make([]uint, len(recipients))
+	keys := make([]string, len(recipients))
+	for i, data := range recipients {
+		templateIDs[i] = selectTemplate(rules, data, templateID)
+		keys[i] = dedupKey(templateIDs[i], data.Email, data.Event)
+		report.Templates[templateIDs[i]]++
+	}
+	existing, err := findActiveCertificates(s.db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	invalid := make(map[int]bool, len(report.Errors))
+	for _, rowErr := range report.Errors {
+		invalid[rowErr.Row] = true
+	}
+
+	rowNumber := func(i int) int {
+		if rows != nil {
+			return rows[i]
+		}
+		return i + 1
+	}
+
+	for i, data := range recipients {
+		row := rowNumber(i)
+
+		if certificate, ok := existing[keys[i]]; ok {
+			report.Warnings = append(report.Warnings, models.RowError{
+				Row:     row,
+				Field:   "email",
+				Message: fmt.Sprintf("certificate %s already exists for this template and event", certificate.Code),
+			})
+		}
+
+		recipient := newRecipient(data)
+		_, renderInput := renderData(templates[templateIDs[i]], recipient, "", "")
+		values := map[string]string{
+			"name":       recipient.Name,
+			"student_id": recipient.StudentID,
+			"course":     recipient.Course,
+			"event":      recipient.Event,
+			"club":       recipient.Club,
+			"date":       recipient.Date,
+		}
+		for _, field := range fields[templateIDs[i]] {
+			if key, ok := strings.CutPrefix(field, "Meta."); ok {
+				if renderInput[pdf.MetaPrefix+key] == "" {
+					report.Warnings = append(report.Warnings, models.RowError{
+						Row:     row,
+						Field:   "metadata." + key,
+						Message: "is empty but used by the template",
+					})
+				}
+				continue
+			}
+			source, ok := templateFieldSources[field]
+			if ok && values[source] == "" {
+				report.Warnings = append(report.Warnings, models.RowError{
+					Row:     row,
+					Field:   source,
+					Message: "is empty but used by the template",
+				})
+			}
+		}
+	}
+
+	if previews == 0 {
+		previews = defaultPreviewCount
+	}
+	if previews > maxPreviewCount {
+		previews = maxPreviewCount
+	}
+
+	var selected []int
+	picked := make(map[int]bool)
+	covered := make(map[uint]bool)
+	for i := range recipients {
+		if len(selected) >= previews {
+			break
+		}
+		if !invalid[rowNumber(i)] && !covered[templateIDs[i]] {
+			selected = append(selected, i)
+			picked[i] = true
+			covered[templateIDs[i]] = true
+		}
+	}
+	for i := range recipients {
+		if len(selected) >= previews {
+			break
+		}
+		if !invalid[rowNumber(i)] && !picked[i] {
+			selected = append(selected, i)
+		}
+	}
+	sort.Ints(selected)
+
+	for _, i := range selected {
+		recipient := newRecipient(recipients[i])
+		report.Previews = append(report.Previews, s.renderPreview(ctx, templates[templateIDs[i]], recipient, rowNumber(i)))
+	}
+
+	return report, nil
+}
+
+func (s *CertificateService) renderPreview(ctx context.Context, template models.Template, recipient models.Recipient, row int) models.RowPreview {
+	verifyURL := s.VerifyURL(&models.Certificate{Code: previewCode})
+	templateName, data := renderData(template, recipient, previewCode, verifyURL)
+
+	png, err := s.pdfGen.GeneratePreview(ctx, templateName, data)
+	if err != nil {
+		return models.RowPreview{Row: row, TemplateID: template.ID, Error: err.Error()}
+	}
+
+	return models.RowPreview{
+		Row:        row,
+		TemplateID: template.ID,
+		Image:      "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}
+}
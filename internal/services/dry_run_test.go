@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"certificate-service/internal/models"
+)
+
+// fieldsRenderer reports the same template fields for every template and
+// fails previews of the recipient named "Broken".
+type fieldsRenderer struct {
+	stubRenderer
+	fields []string
+}
+
+func (r fieldsRenderer) TemplateFields(templateName string) ([]string, error) {
+	return r.fields, nil
+}
+
+func (r fieldsRenderer) GeneratePreview(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	if data["name"] == "Broken" {
+		return nil, errors.New("render failed")
+	}
+	return []byte("png"), nil
+}
+
+func TestDryRunReport(t *testing.T) {
+	db := openTestDB(t)
+	s := &CertificateService{db: db, pdfGen: fieldsRenderer{fields: []string{"Name", "Course", "Meta.team", "Code"}}}
+
+	standard := models.Template{Name: "standard", Config: "{}", IsActive: true}
+	winner := models.Template{Name: "winner", Config: "{}", IsActive: true}
+	for _, template := range []*models.Template{&standard, &winner} {
+		if err := db.Create(template).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recipient := models.Recipient{Name: "Ada Lovelace", Email: "ada@example.com", Event: "Hackathon"}
+	if err := db.Create(&recipient).Error; err != nil {
+		t.Fatal(err)
+	}
+	key := dedupKey(standard.ID, recipient.Email, recipient.Event)
+	if err := db.Create(&models.Certificate{TemplateID: standard.ID, RecipientID: recipient.ID, Code: "EXIST123", Status: "completed", DedupKey: &key}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rules := []models.TemplateRule{{When: map[string]models.RuleValues{"metadata.rank": {"1", "2"}}, TemplateID: winner.ID}}
+	team := map[string]interface{}{"team": "Analytical"}
+	recipients := []models.RecipientData{
+		{Name: "Ada Lovelace", Email: "ada@example.com", Event: "Hackathon", Course: "CSE", Metadata: team},
+		{Name: "Grace Hopper", Email: "not-an-email", Course: "CSE", Metadata: team},
+		{Name: "Alan Turing", Email: "alan@example.com", Metadata: map[string]interface{}{"team": "Bombe", "rank": "1"}},
+		{Name: "Broken", Email: "broken@example.com", Course: "CSE", Metadata: team},
+		{Name: "Edsger Dijkstra", Email: "edsger@example.com", Course: "CSE", Metadata: team},
+	}
+	// Spreadsheet rows, after a header and a blank row.
+	rows := []int{2, 3, 5, 6, 7}
+
+	report, err := s.dryRun(context.Background(), standard.ID, rules, recipients, rows, 0)
+	if err != nil {
+		t.Fatalf("dryRun: %v", err)
+	}
+
+	if report.Valid || report.TotalRows != 5 {
+		t.Errorf("valid %v with %d rows, want invalid with 5", report.Valid, report.TotalRows)
+	}
+	wantTemplates := map[uint]int{standard.ID: 4, winner.ID: 1}
+	if !reflect.DeepEqual(report.Templates, wantTemplates) {
+		t.Errorf("templates %v, want %v", report.Templates, wantTemplates)
+	}
+	wantErrors := []models.RowError{{Row: 3, Field: "email", Message: "is not a valid email address"}}
+	if !reflect.DeepEqual(report.Errors, wantErrors) {
+		t.Errorf("errors %+v, want %+v", report.Errors, wantErrors)
+	}
+	wantWarnings := []models.RowError{
+		{Row: 2, Field: "email", Message: "certificate EXIST123 already exists for this template and event"},
+		{Row: 5, Field: "course", Message: "is empty but used by the template"},
+	}
+	if !reflect.DeepEqual(report.Warnings, wantWarnings) {
+		t.Errorf("warnings %+v, want %+v", report.Warnings, wantWarnings)
+	}
+
+	// The first valid row of each template comes first, then the next
+	// valid row; the invalid row 3 is never previewed.
+	wantPreviews := []models.RowPreview{
+		{Row: 2, TemplateID: standard.ID, Image: "data:image/png;base64,cG5n"},
+		{Row: 5, TemplateID: winner.ID, Image: "data:image/png;base64,cG5n"},
+		{Row: 6, TemplateID: standard.ID, Error: "render failed"},
+	}
+	if !reflect.DeepEqual(report.Previews, wantPreviews) {
+		t.Errorf("previews %+v, want %+v", report.Previews, wantPreviews)
+	}
+}
+
+func TestDryRunPreviewCount(t *testing.T) {
+	db := openTestDB(t)
+	s := &CertificateService{db: db, pdfGen: fieldsRenderer{}}
+
+	template := models.Template{Name: "standard", Config: "{}", IsActive: true}
+	if err := db.Create(&template).Error; err != nil {
+		t.Fatal(err)
+	}
+	recipients := make([]models.RecipientData, 12)
+	for i := range recipients {
+		recipients[i] = models.RecipientData{Name: "Ada Lovelace", Email: "ada@example.com", Event: string(rune('a' + i))}
+	}
+
+	tests := []struct {
+		previews int
+		want     int
+	}{
+		{0, defaultPreviewCount},
+		{-1, 0},
+		{1, 1},
+		{5, 5},
+		{20, maxPreviewCount},
+	}
+	for _, tt := range tests {
+		report, err := s.dryRun(context.Background(), template.ID, nil, recipients, nil, tt.previews)
+		if err != nil {
+			t.Fatalf("dryRun: %v", err)
+		}
+		if len(report.Previews) != tt.want {
+			t.Errorf("previews = %d rendered %d, want %d", tt.previews, len(report.Previews), tt.want)
+		}
+		if !report.Valid || len(report.Errors) != 0 || len(report.Warnings) != 0 {
+			t.Errorf("previews = %d: report %+v, want a clean report", tt.previews, report)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"certificate-service/internal/models"
+	"certificate-service/internal/queue"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobTracker persists queue job lifecycle to Postgres. It implements
+// queue.Tracker.
+type JobTracker struct {
+	db *gorm.DB
+}
+
+type JobFilter struct {
+	Status        string
+	Type          string
+	CertificateID uint
+	BatchID       uint
+	Limit         int
+	Offset        int
+}
+
+func NewJobTracker(db *gorm.DB) *JobTracker {
+	return &JobTracker{db: db}
+}
+
+func (t *JobTracker) JobQueued(ctx context.Context, job queue.Job) {
+	record := models.JobRecord{
+		ID:            job.ID,
+		Type:          job.Type,
+		Status:        "queued",
+		CertificateID: jobDataUint(job, "certificate_id"),
+		BatchID:       jobDataUint(job, "batch_id"),
+		Attempts:      job.Attempts,
+		LastError:     job.LastError,
+		QueuedAt:      time.Now(),
+	}
+
+	// A job ID is queued again when a dead job is requeued or a crashed
+	// worker's job is recovered; keep the row and reset its progress.
+	t.write(ctx, job, func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"status":        "queued",
+				"attempts":      job.Attempts,
+				"last_error":    job.LastError,
+				"queued_at":     record.QueuedAt,
+				"worker_id":     "",
+				"started_at":    nil,
+				"finished_at":   nil,
+				"next_retry_at": nil,
+				"updated_at":    record.QueuedAt,
+			}),
+		}).Create(&record).Error
+	})
+}
+
+func (t *JobTracker) JobStarted(ctx context.Context, job queue.Job, workerID string) {
+	now := time.Now()
+	t.write(ctx, job, func(tx *gorm.DB) error {
+		return tx.Model(&models.JobRecord{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":        "running",
+			"worker_id":     workerID,
+			"attempts":      job.Attempts,
+			"started_at":    now,
+			"next_retry_at": nil,
+			"wait_ms":       gorm.Expr("GREATEST(EXTRACT(EPOCH FROM (? - queued_at)) * 1000, 0)::bigint", now),
+		}).Error
+	})
+}
+
+func (t *JobTracker) JobSucceeded(ctx context.Context, job queue.Job, duration time.Duration) {
+	t.finish(ctx, job, "succeeded", duration, nil)
+}
+
+func (t *JobTracker) JobRetrying(ctx context.Context, job queue.Job, duration time.Duration, retryAt time.Time) {
+	t.finish(ctx, job, "retrying", duration, &retryAt)
+}
+
+func (t *JobTracker) JobDead(ctx context.Context, job queue.Job, duration time.Duration) {
+	t.finish(ctx, job, "dead", duration, nil)
+}
+
+func (t *JobTracker) finish(ctx context.Context, job queue.Job, status string, duration time.Duration, retryAt *time.Time) {
+	updates := map[string]interface{}{
+		"status":        status,
+		"attempts":      job.Attempts,
+		"last_error":    job.LastError,
+		"run_ms":        duration.Milliseconds(),
+		"next_retry_at": retryAt,
+	}
+	if retryAt == nil {
+		updates["finished_at"] = time.Now()
+	}
+
+	t.write(ctx, job, func(tx *gorm.DB) error {
+		return tx.Model(&models.JobRecord{}).Where("id = ?", job.ID).Updates(updates).Error
+	})
+}
+
+// write detaches from the job's context so a shutdown mid-job still records
+// what happened to it.
+func (t *JobTracker) write(ctx context.Context, job queue.Job, fn func(tx *gorm.DB) error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if err := fn(t.db.WithContext(ctx)); err != nil {
+		log.Printf("Job tracker: failed to record %s: %v", job.ID, err)
+	}
+}
+
+func (t *JobTracker) GetJob(id string) (*models.JobRecord, error) {
+	var record models.JobRecord
+	if err := t.db.Where("id = ?", id).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (t *JobTracker) ListJobs(filter JobFilter) ([]models.JobRecord, int64, error) {
+	query := t.db.Model(&models.JobRecord{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.CertificateID > 0 {
+		query = query.Where("certificate_id = ?", filter.CertificateID)
+	}
+	if filter.BatchID > 0 {
+		query = query.Where("batch_id = ?", filter.BatchID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 50
+	}
+
+	var records []models.JobRecord
+	if err := query.Order("updated_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return records, total, nil
+}
+
+// LastCertificateError returns the most recent job error recorded for a
+// certificate, or "" if its jobs have not failed.
+func (t *JobTracker) LastCertificateError(certificateID uint) string {
+	var record models.JobRecord
+	err := t.db.Where("certificate_id = ? AND last_error <> ''", certificateID).
+		Order("updated_at DESC").
+		First(&record).Error
+	if err != nil {
+		return ""
+	}
+	return record.LastError
+}
+
+func jobDataUint(job queue.Job, key string) *uint {
+	v, ok := jobUint(job.Data[key])
+	if !ok || v == 0 {
+		return nil
+	}
+	return &v
+}
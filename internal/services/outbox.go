@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"certificate-service/internal/models"
+	"certificate-service/internal/queue"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const outboxDispatchSize = 500
+
+func newOutboxJob(job queue.Job, batchID *uint) (models.OutboxJob, error) {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return models.OutboxJob{}, fmt.Errorf("failed to marshal job: %w", err)
+	}
+	return models.OutboxJob{
+		JobID:   job.ID,
+		BatchID: batchID,
+		Payload: payload,
+	}, nil
+}
+
+// addOutboxJob writes a job to the outbox in tx. It is enqueued once tx
+// commits, by dispatchOutboxJob or else by the outbox relay.
+func addOutboxJob(tx *gorm.DB, job queue.Job, batchID *uint) error {
+	row, err := newOutboxJob(job, batchID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+	return nil
+}
+
+// dispatchOutbox pushes outbox jobs to the queue, optionally only those of
+// one batch, and reports how many were enqueued. Rows are locked with SKIP
+// LOCKED and deleted in the same transaction, so concurrent dispatchers
+// never push the same job twice; if Redis is unavailable the transaction
+// rolls back and the rows stay for the next attempt.
+func (s *CertificateService) dispatchOutbox(ctx context.Context, batchID *uint) (int, error) {
+	dispatched := 0
+	for {
+		n, err := s.dispatchOutboxChunk(ctx, batchID)
+		dispatched += n
+		if err != nil {
+			return dispatched, err
+		}
+		if n < outboxDispatchSize {
+			return dispatched, nil
+		}
+	}
+}
+
+// dispatchOutboxJob pushes one outbox job to the queue, if no other
+// dispatcher has already.
+func (s *CertificateService) dispatchOutboxJob(ctx context.Context, jobID string) error {
+	_, err := s.dispatchOutboxRows(ctx, func(query *gorm.DB) *gorm.DB {
+		return query.Where("job_id = ?", jobID)
+	})
+	return err
+}
+
+// dispatchAfterCommit enqueues a job written with addOutboxJob. A failure
+// only delays the job until the relay's next pass, so it is logged rather
+// than returned.
+func (s *CertificateService) dispatchAfterCommit(ctx context.Context, jobID string) {
+	if err := s.dispatchOutboxJob(context.WithoutCancel(ctx), jobID); err != nil {
+		log.Printf("Job %s: deferring enqueue to outbox relay: %v", jobID, err)
+	}
+}
+
+func (s *CertificateService) dispatchOutboxChunk(ctx context.Context, batchID *uint) (int, error) {
+	return s.dispatchOutboxRows(ctx, func(query *gorm.DB) *gorm.DB {
+		if batchID != nil {
+			return query.Where("batch_id = ?", *batchID)
+		}
+		return query
+	})
+}
+
+// dispatchOutboxRows enqueues and deletes up to outboxDispatchSize outbox
+// rows picked by filter.
+func (s *CertificateService) dispatchOutboxRows(ctx context.Context, filter func(*gorm.DB) *gorm.DB) (int, error) {
+	n := 0
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := filter(tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Order("id").
+			Limit(outboxDispatchSize))
+
+		var rows []models.OutboxJob
+		if err := query.Find(&rows).Error; err != nil {
+			return fmt.Errorf("failed to load outbox: %w", err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		jobs := make([]queue.Job, 0, len(rows))
+		ids := make([]uint, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.ID)
+
+			var job queue.Job
+			if err := json.Unmarshal(row.Payload, &job); err != nil {
+				log.Printf("Outbox: dropping unreadable job %s: %v", row.JobID, err)
+				continue
+			}
+			jobs = append(jobs, job)
+		}
+
+		if err := s.queue.EnqueueBatch(ctx, jobs); err != nil {
+			return fmt.Errorf("failed to enqueue outbox jobs: %w", err)
+		}
+
+		if err := tx.Delete(&models.OutboxJob{}, ids).Error; err != nil {
+			return fmt.Errorf("failed to clear outbox: %w", err)
+		}
+
+		n = len(rows)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// StartOutboxRelay periodically dispatches outbox jobs left behind when the
+// post-commit dispatch failed or the process died before it ran.
+func (s *CertificateService) StartOutboxRelay(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			n, err := s.dispatchOutbox(ctx, nil)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Outbox relay: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Outbox relay: enqueued %d jobs", n)
+			}
+		}
+	}
+}
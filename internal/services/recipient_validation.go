@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"certificate-service/internal/models"
+)
+
+// ValidationError reports every recipient row that was rejected, so a
+// caller can fix them all at once instead of resubmitting row by row.
+type ValidationError struct {
+	Rows []models.RowError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Rows) == 1 {
+		return "1 recipient row is invalid"
+	}
+	return fmt.Sprintf("%d recipient rows are invalid", len(e.Rows))
+}
+
+// validateRecipients checks each recipient and returns one error per bad
+// field. rows gives the row number reported for each recipient; if nil,
+// rows are numbered from 1.
+func validateRecipients(recipients []models.RecipientData, rows []int) []models.RowError {
+	var rowErrors []models.RowError
+	firstSeen := make(map[string]int)
+
+	for i, recipient := range recipients {
+		row := i + 1
+		if rows != nil {
+			row = rows[i]
+		}
+
+		rowErrors = append(rowErrors, validateRecipient(row, recipient)...)
+
+		if recipient.Email == "" {
+			continue
+		}
+		key := recipientKey(recipient)
+		if first, ok := firstSeen[key]; ok {
+			rowErrors = append(rowErrors, models.RowError{
+				Row:     row,
+				Field:   "email",
+				Message: fmt.Sprintf("duplicates row %d for the same event", first),
+			})
+			continue
+		}
+		firstSeen[key] = row
+	}
+
+	return rowErrors
+}
+
+func validateRecipient(row int, recipient models.RecipientData) []models.RowError {
+	var rowErrors []models.RowError
+
+	if strings.TrimSpace(recipient.Name) == "" {
+		rowErrors = append(rowErrors, models.RowError{Row: row, Field: "name", Message: "is required"})
+	}
+
+	email := strings.TrimSpace(recipient.Email)
+	if email == "" {
+		rowErrors = append(rowErrors, models.RowError{Row: row, Field: "email", Message: "is required"})
+	} else if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		rowErrors = append(rowErrors, models.RowError{Row: row, Field: "email", Message: "is not a valid email address"})
+	}
+
+	return rowErrors
+}
+
+// recipientKey identifies a recipient within one request: the same address
+// may receive certificates for different events, but not twice for one.
+func recipientKey(recipient models.RecipientData) string {
+	return strings.ToLower(strings.TrimSpace(recipient.Email)) + "\x00" + strings.ToLower(strings.TrimSpace(recipient.Event))
+}
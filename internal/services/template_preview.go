@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"certificate-service/internal/models"
+	"certificate-service/pkg/pdf"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PreviewFormatPDF = "pdf"
+	PreviewFormatPNG = "png"
+)
+
+// ErrPreviewFailed is returned when a template cannot be rendered, which is
+// a problem with the template rather than the service.
+var ErrPreviewFailed = errors.New("failed to render preview")
+
+// PreviewTemplate renders a template for a sample recipient, or the given
+// one, as a PDF or PNG. version 0 renders the current version. Nothing is
+// stored and no job is queued.
+func (s *CertificateService) PreviewTemplate(ctx context.Context, templateID uint, version int, data *models.RecipientData, format string) ([]byte, error) {
+	var template models.Template
+	if err := s.db.First(&template, templateID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, err
+	}
+
+	template, err := templateAtVersion(s.db, template, version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: version %d", ErrTemplateNotFound, version)
+		}
+		return nil, err
+	}
+
+	if data == nil {
+		sample := sampleRecipient()
+		data = &sample
+	}
+	recipient := newRecipient(*data)
+
+	verifyURL := s.VerifyURL(&models.Certificate{Code: previewCode})
+	templateName, renderInput := renderData(template, recipient, previewCode, verifyURL)
+
+	var output []byte
+	switch format {
+	case PreviewFormatPNG:
+		output, err = s.pdfGen.GeneratePreview(ctx, templateName, renderInput)
+	default:
+		output, err = s.pdfGen.GenerateWithTemplate(ctx, templateName, renderInput)
+	}
+	if errors.Is(err, pdf.ErrInvalidTemplate) || errors.Is(err, pdf.ErrRendererUnavailable) {
+		return nil, fmt.Errorf("%w: %v", ErrPreviewFailed, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to render preview: %w", err)
+	}
+
+	return output, nil
+}
+
+// sampleRecipient fills template previews when no recipient is given.
+func sampleRecipient() models.RecipientData {
+	return models.RecipientData{
+		Name:      "Jane Doe",
+		Email:     "jane.doe@example.com",
+		Course:    "B.Tech Computer Science",
+		Event:     "Sample Event",
+		Club:      "Sample Club",
+		Date:      time.Now().Format("January 2, 2006"),
+		StudentID: "21012345",
+	}
+}
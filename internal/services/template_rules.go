@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"certificate-service/internal/models"
+)
+
+// ErrInvalidTemplateRules is returned when a batch's template rules refer to
+// unknown fields or templates.
+var ErrInvalidTemplateRules = errors.New("invalid template rules")
+
+// loadBatchTemplates checks a batch's template rules and loads the default
+// template together with every template the rules can select, keyed by ID.
+func (s *CertificateService) loadBatchTemplates(defaultID uint, rules []models.TemplateRule) (map[uint]models.Template, error) {
+	ids := []uint{defaultID}
+	for i, rule := range rules {
+		if rule.TemplateID == 0 {
+			return nil, fmt.Errorf("%w: rule %d has no template_id", ErrInvalidTemplateRules, i+1)
+		}
+		if len(rule.When) == 0 {
+			return nil, fmt.Errorf("%w: rule %d has no conditions", ErrInvalidTemplateRules, i+1)
+		}
+		for field := range rule.When {
+			if !isRecipientTarget(field) {
+				return nil, fmt.Errorf("%w: rule %d uses unknown field %q", ErrInvalidTemplateRules, i+1, field)
+			}
+		}
+		ids = append(ids, rule.TemplateID)
+	}
+
+	var templates []models.Template
+	if err := s.db.Where("id IN ? AND is_active = ?", ids, true).Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
+
+	byID := make(map[uint]models.Template, len(templates))
+	for _, template := range templates {
+		byID[template.ID] = template
+	}
+
+	if _, ok := byID[defaultID]; !ok {
+		return nil, fmt.Errorf("template not found: %d", defaultID)
+	}
+	for i, rule := range rules {
+		if _, ok := byID[rule.TemplateID]; !ok {
+			return nil, fmt.Errorf("%w: template %d in rule %d not found", ErrInvalidTemplateRules, rule.TemplateID, i+1)
+		}
+	}
+
+	return byID, nil
+}
+
+// selectTemplate returns the template of the first rule the recipient
+// matches, or defaultID.
+func selectTemplate(rules []models.TemplateRule, recipient models.RecipientData, defaultID uint) uint {
+	for _, rule := range rules {
+		if ruleMatches(rule, recipient) {
+			return rule.TemplateID
+		}
+	}
+	return defaultID
+}
+
+func ruleMatches(rule models.TemplateRule, recipient models.RecipientData) bool {
+	for field, values := range rule.When {
+		actual := strings.TrimSpace(recipientFieldValue(recipient, field))
+		matched := false
+		for _, value := range values {
+			if strings.EqualFold(actual, strings.TrimSpace(value)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func recipientFieldValue(recipient models.RecipientData, field string) string {
+	if key, ok := strings.CutPrefix(field, "metadata."); ok {
+		value, ok := recipient.Metadata[key]
+		if !ok || value == nil {
+			return ""
+		}
+		return fmt.Sprint(value)
+	}
+
+	switch field {
+	case "name":
+		return recipient.Name
+	case "email":
+		return recipient.Email
+	case "course":
+		return recipient.Course
+	case "event":
+		return recipient.Event
+	case "club":
+		return recipient.Club
+	case "date":
+		return recipient.Date
+	case "student_id":
+		return recipient.StudentID
+	}
+	return ""
+}
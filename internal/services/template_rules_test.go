@@ -0,0 +1,145 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"certificate-service/internal/models"
+)
+
+func TestSelectTemplate(t *testing.T) {
+	rules := []models.TemplateRule{
+		{When: map[string]models.RuleValues{"metadata.rank": {"1", "2", "3"}, "event": {"Hackathon"}}, TemplateID: 2},
+		{When: map[string]models.RuleValues{"club": {"Robotics Club"}}, TemplateID: 3},
+		{When: map[string]models.RuleValues{"metadata.rank": {"1"}}, TemplateID: 4},
+	}
+
+	tests := []struct {
+		name      string
+		recipient models.RecipientData
+		want      uint
+	}{
+		{
+			name:      "no rule matches",
+			recipient: models.RecipientData{Event: "Workshop", Club: "Coding Club"},
+			want:      1,
+		},
+		{
+			name:      "every condition of a rule matches",
+			recipient: models.RecipientData{Event: "Hackathon", Metadata: map[string]interface{}{"rank": "2"}},
+			want:      2,
+		},
+		{
+			name:      "case and surrounding spaces ignored",
+			recipient: models.RecipientData{Event: " hackathon ", Metadata: map[string]interface{}{"rank": " 3"}},
+			want:      2,
+		},
+		{
+			name:      "first matching rule wins",
+			recipient: models.RecipientData{Event: "Hackathon", Club: "Robotics Club", Metadata: map[string]interface{}{"rank": "1"}},
+			want:      2,
+		},
+		{
+			name:      "partial match falls through",
+			recipient: models.RecipientData{Event: "Workshop", Metadata: map[string]interface{}{"rank": "1"}},
+			want:      4,
+		},
+		{
+			name:      "non-string metadata",
+			recipient: models.RecipientData{Event: "Workshop", Metadata: map[string]interface{}{"rank": float64(1)}},
+			want:      4,
+		},
+		{
+			name:      "missing metadata",
+			recipient: models.RecipientData{Event: "Hackathon"},
+			want:      1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectTemplate(rules, tt.recipient, 1); got != tt.want {
+				t.Errorf("selectTemplate = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleValuesUnmarshal(t *testing.T) {
+	tests := []struct {
+		data string
+		want models.RuleValues
+	}{
+		{`"Hackathon"`, models.RuleValues{"Hackathon"}},
+		{`["1", "2"]`, models.RuleValues{"1", "2"}},
+	}
+	for _, tt := range tests {
+		var got models.RuleValues
+		if err := json.Unmarshal([]byte(tt.data), &got); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", tt.data, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Unmarshal(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestLoadBatchTemplates(t *testing.T) {
+	db := openTestDB(t)
+	s := &CertificateService{db: db}
+
+	standard := models.Template{Name: "standard", Config: "{}", IsActive: true}
+	winner := models.Template{Name: "winner", Config: "{}", IsActive: true}
+	retired := models.Template{Name: "retired", Config: "{}", IsActive: true}
+	for _, template := range []*models.Template{&standard, &winner, &retired} {
+		if err := db.Create(template).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Model(&retired).Update("is_active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	when := map[string]models.RuleValues{"event": {"Hackathon"}}
+	tests := []struct {
+		name    string
+		rules   []models.TemplateRule
+		want    []uint
+		wantErr string
+	}{
+		{name: "no rules", want: []uint{standard.ID}},
+		{name: "rule template", rules: []models.TemplateRule{{When: when, TemplateID: winner.ID}}, want: []uint{standard.ID, winner.ID}},
+		{name: "no template", rules: []models.TemplateRule{{When: when}}, wantErr: "rule 1 has no template_id"},
+		{name: "no conditions", rules: []models.TemplateRule{{TemplateID: winner.ID}}, wantErr: "rule 1 has no conditions"},
+		{
+			name:    "unknown field",
+			rules:   []models.TemplateRule{{When: when, TemplateID: winner.ID}, {When: map[string]models.RuleValues{"rank": {"1"}}, TemplateID: winner.ID}},
+			wantErr: `rule 2 uses unknown field "rank"`,
+		},
+		{name: "inactive template", rules: []models.TemplateRule{{When: when, TemplateID: retired.ID}}, wantErr: "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates, err := s.loadBatchTemplates(standard.ID, tt.rules)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidTemplateRules) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadBatchTemplates = %v, want ErrInvalidTemplateRules mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadBatchTemplates: %v", err)
+			}
+			if len(templates) != len(tt.want) {
+				t.Errorf("loaded %d templates, want %v", len(templates), tt.want)
+			}
+			for _, id := range tt.want {
+				if _, ok := templates[id]; !ok {
+					t.Errorf("template %d not loaded", id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,591 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"certificate-service/internal/models"
+	"certificate-service/pkg/pdf"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTemplateNotFound  = errors.New("template not found")
+	ErrTemplateInUse     = errors.New("template is in use")
+	ErrTemplateNameTaken = errors.New("template name already exists")
+)
+
+// TemplateService manages certificate and email templates. Changing a
+// template's rendered content creates a new immutable version; the old
+// versions stay available to certificates created with them.
+type TemplateService struct {
+	db     *gorm.DB
+	pdfGen pdf.Renderer
+	assets *AssetService
+}
+
+func NewTemplateService(db *gorm.DB, pdfGen pdf.Renderer, assets *AssetService) *TemplateService {
+	return &TemplateService{db: db, pdfGen: pdfGen, assets: assets}
+}
+
+func (s *TemplateService) CreateTemplate(req models.CreateTemplateRequest) (*models.Template, error) {
+	if err := s.validateConfig(req.Config); err != nil {
+		return nil, err
+	}
+
+	configJSON, err := json.Marshal(req.Config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config format: %w", err)
+	}
+
+	template := models.Template{
+		Name:        req.Name,
+		Description: req.Description,
+		Config:      string(configJSON),
+		IsActive:    true,
+		Version:     1,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkNameFree(tx, &models.Template{}, req.Name, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&template).Error; err != nil {
+			return fmt.Errorf("failed to create template: %w", err)
+		}
+		return s.createTemplateVersion(tx, &template)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+func (s *TemplateService) ListTemplates(includeInactive bool) ([]models.Template, error) {
+	query := s.db.Order("id")
+	if !includeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var templates []models.Template
+	if err := query.Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (s *TemplateService) GetTemplate(id uint) (*models.Template, error) {
+	var template models.Template
+	if err := s.db.First(&template, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, err
+	}
+	return &template, nil
+}
+
+// ReplaceTemplate overwrites every field of a template, as for PUT.
+func (s *TemplateService) ReplaceTemplate(id uint, req models.ReplaceTemplateRequest) (*models.Template, error) {
+	return s.UpdateTemplate(id, models.UpdateTemplateRequest{
+		Name:        &req.Name,
+		Description: &req.Description,
+		Config:      req.Config,
+		IsActive:    req.IsActive,
+	})
+}
+
+// UpdateTemplate changes the fields set in req. A config change creates a
+// new version; name, description and is_active do not affect rendering and
+// are updated in place.
+func (s *TemplateService) UpdateTemplate(id uint, req models.UpdateTemplateRequest) (*models.Template, error) {
+	if req.Config != nil {
+		if err := s.validateConfig(req.Config); err != nil {
+			return nil, err
+		}
+	}
+
+	var template models.Template
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockRecord(tx, id, &template); err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		if req.Name != nil && *req.Name != template.Name {
+			if err := checkNameFree(tx, &models.Template{}, *req.Name, template.ID); err != nil {
+				return err
+			}
+			updates["name"] = *req.Name
+		}
+		if req.Description != nil {
+			updates["description"] = *req.Description
+		}
+		if req.IsActive != nil {
+			updates["is_active"] = *req.IsActive
+		}
+
+		if req.Config != nil {
+			configJSON, err := json.Marshal(req.Config)
+			if err != nil {
+				return fmt.Errorf("invalid config format: %w", err)
+			}
+			if !sameJSON(template.Config, string(configJSON)) {
+				// Templates created before versioning have no snapshot of
+				// the version being replaced.
+				if err := s.ensureTemplateVersion(tx, &template); err != nil {
+					return err
+				}
+				template.Config = string(configJSON)
+				template.Version++
+				if err := s.createTemplateVersion(tx, &template); err != nil {
+					return err
+				}
+				updates["config"] = template.Config
+				updates["version"] = template.Version
+			}
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&template).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update template: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// DeleteTemplate removes a template and its versions. Templates that
+// certificates or batches refer to cannot be deleted, only deactivated.
+func (s *TemplateService) DeleteTemplate(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var template models.Template
+		if err := lockRecord(tx, id, &template); err != nil {
+			return err
+		}
+
+		var certificates, batches int64
+		if err := tx.Unscoped().Model(&models.Certificate{}).Where("template_id = ?", id).Count(&certificates).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.CertificateBatch{}).Where("template_id = ?", id).Count(&batches).Error; err != nil {
+			return err
+		}
+		if certificates > 0 || batches > 0 {
+			return fmt.Errorf("%w: used by %d certificates and %d batches; deactivate it instead", ErrTemplateInUse, certificates, batches)
+		}
+
+		if err := tx.Where("template_id = ?", id).Delete(&models.TemplateVersion{}).Error; err != nil {
+			return fmt.Errorf("failed to delete template versions: %w", err)
+		}
+		if err := tx.Delete(&template).Error; err != nil {
+			return fmt.Errorf("failed to delete template: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *TemplateService) ListTemplateVersions(id uint) ([]models.TemplateVersion, error) {
+	if _, err := s.GetTemplate(id); err != nil {
+		return nil, err
+	}
+
+	var versions []models.TemplateVersion
+	if err := s.db.Where("template_id = ?", id).Order("version").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (s *TemplateService) GetTemplateVersion(id uint, version int) (*models.TemplateVersion, error) {
+	var templateVersion models.TemplateVersion
+	err := s.db.Where("template_id = ? AND version = ?", id, version).First(&templateVersion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &templateVersion, nil
+}
+
+func (s *TemplateService) CreateEmailTemplate(req models.CreateEmailTemplateRequest) (*models.EmailTemplate, error) {
+	emailTemplate := models.EmailTemplate{
+		Name:     req.Name,
+		Subject:  req.Subject,
+		BodyHTML: req.BodyHTML,
+		BodyText: req.BodyText,
+		IsActive: true,
+		Version:  1,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkNameFree(tx, &models.EmailTemplate{}, req.Name, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&emailTemplate).Error; err != nil {
+			return fmt.Errorf("failed to create email template: %w", err)
+		}
+		return createEmailTemplateVersion(tx, &emailTemplate)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &emailTemplate, nil
+}
+
+func (s *TemplateService) ListEmailTemplates(includeInactive bool) ([]models.EmailTemplate, error) {
+	query := s.db.Order("id")
+	if !includeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var templates []models.EmailTemplate
+	if err := query.Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (s *TemplateService) GetEmailTemplate(id uint) (*models.EmailTemplate, error) {
+	var emailTemplate models.EmailTemplate
+	if err := s.db.First(&emailTemplate, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, err
+	}
+	return &emailTemplate, nil
+}
+
+func (s *TemplateService) ReplaceEmailTemplate(id uint, req models.ReplaceEmailTemplateRequest) (*models.EmailTemplate, error) {
+	return s.UpdateEmailTemplate(id, models.UpdateEmailTemplateRequest{
+		Name:     &req.Name,
+		Subject:  &req.Subject,
+		BodyHTML: &req.BodyHTML,
+		BodyText: &req.BodyText,
+		IsActive: req.IsActive,
+	})
+}
+
+// UpdateEmailTemplate changes the fields set in req. A change to the
+// subject or either body creates a new version.
+func (s *TemplateService) UpdateEmailTemplate(id uint, req models.UpdateEmailTemplateRequest) (*models.EmailTemplate, error) {
+	var emailTemplate models.EmailTemplate
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockRecord(tx, id, &emailTemplate); err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		if req.Name != nil && *req.Name != emailTemplate.Name {
+			if err := checkNameFree(tx, &models.EmailTemplate{}, *req.Name, emailTemplate.ID); err != nil {
+				return err
+			}
+			updates["name"] = *req.Name
+		}
+		if req.IsActive != nil {
+			updates["is_active"] = *req.IsActive
+		}
+
+		changed := emailTemplate
+		if req.Subject != nil {
+			changed.Subject = *req.Subject
+		}
+		if req.BodyHTML != nil {
+			changed.BodyHTML = *req.BodyHTML
+		}
+		if req.BodyText != nil {
+			changed.BodyText = *req.BodyText
+		}
+
+		if changed.Subject != emailTemplate.Subject || changed.BodyHTML != emailTemplate.BodyHTML || changed.BodyText != emailTemplate.BodyText {
+			if err := ensureEmailTemplateVersion(tx, &emailTemplate); err != nil {
+				return err
+			}
+			changed.Version++
+			if err := createEmailTemplateVersion(tx, &changed); err != nil {
+				return err
+			}
+			updates["subject"] = changed.Subject
+			updates["body_html"] = changed.BodyHTML
+			updates["body_text"] = changed.BodyText
+			updates["version"] = changed.Version
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&emailTemplate).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update email template: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &emailTemplate, nil
+}
+
+// DeleteEmailTemplate removes an email template and its versions unless a
+// certificate was sent with it.
+func (s *TemplateService) DeleteEmailTemplate(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var emailTemplate models.EmailTemplate
+		if err := lockRecord(tx, id, &emailTemplate); err != nil {
+			return err
+		}
+
+		var certificates int64
+		if err := tx.Unscoped().Model(&models.Certificate{}).Where("email_template_id = ?", id).Count(&certificates).Error; err != nil {
+			return err
+		}
+		if certificates > 0 {
+			return fmt.Errorf("%w: sent with %d certificates; deactivate it instead", ErrTemplateInUse, certificates)
+		}
+
+		if err := tx.Where("email_template_id = ?", id).Delete(&models.EmailTemplateVersion{}).Error; err != nil {
+			return fmt.Errorf("failed to delete email template versions: %w", err)
+		}
+		if err := tx.Delete(&emailTemplate).Error; err != nil {
+			return fmt.Errorf("failed to delete email template: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *TemplateService) ListEmailTemplateVersions(id uint) ([]models.EmailTemplateVersion, error) {
+	if _, err := s.GetEmailTemplate(id); err != nil {
+		return nil, err
+	}
+
+	var versions []models.EmailTemplateVersion
+	if err := s.db.Where("email_template_id = ?", id).Order("version").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (s *TemplateService) GetEmailTemplateVersion(id uint, version int) (*models.EmailTemplateVersion, error) {
+	var emailTemplateVersion models.EmailTemplateVersion
+	err := s.db.Where("email_template_id = ? AND version = ?", id, version).First(&emailTemplateVersion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &emailTemplateVersion, nil
+}
+
+// templateAtVersion returns the template as it was at the given version.
+// Version 0 marks certificates from before versioning, which use the
+// current config.
+func templateAtVersion(db *gorm.DB, template models.Template, version int) (models.Template, error) {
+	if version == 0 {
+		version = template.Version
+	}
+
+	var templateVersion models.TemplateVersion
+	err := db.Where("template_id = ? AND version = ?", template.ID, version).First(&templateVersion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && version == template.Version {
+		// Templates created before versioning have no row for their
+		// current version yet.
+		return template, nil
+	}
+	if err != nil {
+		return template, fmt.Errorf("template %d version %d not found: %w", template.ID, version, err)
+	}
+
+	config, err := withFileCopies(templateVersion.Config, templateVersion.Files)
+	if err != nil {
+		return template, fmt.Errorf("template %d version %d: %w", template.ID, version, err)
+	}
+	template.Config = config
+	template.Version = templateVersion.Version
+	return template, nil
+}
+
+// withFileCopies points the file settings of a version's config at the
+// copies of the bundled files taken when the version was created.
+func withFileCopies(config, files string) (string, error) {
+	var copies map[string]string
+	if files != "" {
+		if err := json.Unmarshal([]byte(files), &copies); err != nil {
+			return "", fmt.Errorf("invalid file copies: %w", err)
+		}
+	}
+	if len(copies) == 0 {
+		return config, nil
+	}
+
+	values, err := fileSettings(config)
+	if err != nil {
+		return "", err
+	}
+	for key, name := range fileNames(values) {
+		if copies[name] != "" {
+			values[key] = copies[name]
+		}
+	}
+
+	configJSON, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(configJSON), nil
+}
+
+// fileSettings decodes a template config with the template name filled in
+// when it is left to the default.
+func fileSettings(config string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &values); err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	if _, ok := values["template_name"]; !ok {
+		values["template_name"] = defaultTemplateName
+	}
+	return values, nil
+}
+
+// fileNames maps the file settings of a decoded config to the files they
+// name, including the default images an HTML template falls back to for
+// settings left out or empty.
+func fileNames(values map[string]interface{}) map[string]string {
+	templateName, _ := values["template_name"].(string)
+	names := make(map[string]string)
+	for _, key := range templateFileKeys() {
+		name, _ := values[key].(string)
+		if name == "" && !pdf.IsOverlayTemplate(templateName) {
+			name = pdf.DefaultImages[key]
+		}
+		if name != "" {
+			names[key] = name
+		}
+	}
+	return names
+}
+
+// createTemplateVersion records the template's current config, with copies
+// of the bundled files it names or falls back to so that later changes to
+// them do not alter the version.
+func (s *TemplateService) createTemplateVersion(tx *gorm.DB, template *models.Template) error {
+	copies := map[string]string{}
+	if s.assets != nil {
+		values, err := fileSettings(template.Config)
+		if err != nil {
+			return err
+		}
+		names := fileNames(values)
+		for _, key := range templateFileKeys() {
+			name := names[key]
+			if name == "" || copies[name] != "" {
+				continue
+			}
+			snapshot, err := s.assets.snapshotBundled(tx, name)
+			if err != nil {
+				return fmt.Errorf("failed to copy %s for template version: %w", name, err)
+			}
+			if snapshot != "" {
+				copies[name] = snapshot
+			}
+		}
+	}
+
+	files, err := json.Marshal(copies)
+	if err != nil {
+		return err
+	}
+	version := models.TemplateVersion{
+		TemplateID: template.ID,
+		Version:    template.Version,
+		Config:     template.Config,
+		Files:      string(files),
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return fmt.Errorf("failed to create template version: %w", err)
+	}
+	return nil
+}
+
+func (s *TemplateService) ensureTemplateVersion(tx *gorm.DB, template *models.Template) error {
+	var count int64
+	if err := tx.Model(&models.TemplateVersion{}).Where("template_id = ? AND version = ?", template.ID, template.Version).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return s.createTemplateVersion(tx, template)
+}
+
+func createEmailTemplateVersion(tx *gorm.DB, emailTemplate *models.EmailTemplate) error {
+	version := models.EmailTemplateVersion{
+		EmailTemplateID: emailTemplate.ID,
+		Version:         emailTemplate.Version,
+		Subject:         emailTemplate.Subject,
+		BodyHTML:        emailTemplate.BodyHTML,
+		BodyText:        emailTemplate.BodyText,
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return fmt.Errorf("failed to create email template version: %w", err)
+	}
+	return nil
+}
+
+func ensureEmailTemplateVersion(tx *gorm.DB, emailTemplate *models.EmailTemplate) error {
+	var count int64
+	if err := tx.Model(&models.EmailTemplateVersion{}).Where("email_template_id = ? AND version = ?", emailTemplate.ID, emailTemplate.Version).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return createEmailTemplateVersion(tx, emailTemplate)
+}
+
+func lockRecord(tx *gorm.DB, id uint, dest interface{}) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(dest, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTemplateNotFound
+	}
+	return err
+}
+
+func checkNameFree(tx *gorm.DB, model interface{}, name string, exceptID uint) error {
+	var count int64
+	if err := tx.Model(model).Where("name = ? AND id <> ?", name, exceptID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s", ErrTemplateNameTaken, name)
+	}
+	return nil
+}
+
+func sameJSON(a, b string) bool {
+	var x, y interface{}
+	if json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(x, y)
+}
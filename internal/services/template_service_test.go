@@ -0,0 +1,143 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"certificate-service/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func TestTemplateVersionsKeepBundledFiles(t *testing.T) {
+	db := openTestDB(t)
+	bundledDir := t.TempDir()
+	writeFile := func(name, data string) {
+		t.Helper()
+		path := filepath.Join(bundledDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("gala.html", "<p>first</p>")
+	writeFile("images/logo.svg", "<svg/>")
+	writeFile("side.svg", "<svg>first</svg>")
+	writeFile("images/cc.png", "png")
+
+	assets := NewAssetService(db, bundledDir)
+	s := &TemplateService{db: db, assets: assets}
+
+	template := models.Template{
+		Name:    "gala",
+		Config:  `{"template_name":"gala.html","org_logo":"logo.svg","club_logo":"uploaded.svg","signature1":""}`,
+		Version: 1,
+	}
+	createVersion := func() {
+		t.Helper()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if template.ID == 0 {
+				if err := tx.Create(&template).Error; err != nil {
+					return err
+				}
+			}
+			return s.createTemplateVersion(tx, &template)
+		})
+		if err != nil {
+			t.Fatalf("createTemplateVersion: %v", err)
+		}
+	}
+	configAt := func(version int) map[string]interface{} {
+		t.Helper()
+		versioned, err := templateAtVersion(db, template, version)
+		if err != nil {
+			t.Fatalf("templateAtVersion(%d): %v", version, err)
+		}
+		var config map[string]interface{}
+		if err := json.Unmarshal([]byte(versioned.Config), &config); err != nil {
+			t.Fatal(err)
+		}
+		return config
+	}
+	assetData := func(name interface{}) string {
+		t.Helper()
+		data, ok, err := assets.Asset(name.(string))
+		if err != nil || !ok {
+			t.Fatalf("Asset(%v) = %v, %v", name, ok, err)
+		}
+		return string(data)
+	}
+
+	createVersion()
+
+	// Redeploying a changed template file does not change version 1.
+	writeFile("gala.html", "<p>second</p>")
+	writeFile("side.svg", "<svg>second</svg>")
+	template.Version = 2
+	createVersion()
+
+	first, second := configAt(1), configAt(0)
+	if got := assetData(first["template_name"]); got != "<p>first</p>" {
+		t.Errorf("version 1 renders %q", got)
+	}
+	if got := assetData(second["template_name"]); got != "<p>second</p>" {
+		t.Errorf("version 2 renders %q", got)
+	}
+	if first["org_logo"] == "logo.svg" || first["org_logo"] != second["org_logo"] {
+		t.Errorf("org_logo = %v and %v, want one shared copy", first["org_logo"], second["org_logo"])
+	}
+	if got := assetData(first["org_logo"]); got != "<svg/>" {
+		t.Errorf("org_logo copy = %q", got)
+	}
+	// Images left to the defaults are copied too.
+	if got := assetData(first["side_design"]); got != "<svg>first</svg>" {
+		t.Errorf("version 1 default side_design = %q", got)
+	}
+	if got := assetData(second["side_design"]); got != "<svg>second</svg>" {
+		t.Errorf("version 2 default side_design = %q", got)
+	}
+	if got := assetData(first["signature1"]); got != "png" {
+		t.Errorf("empty signature1 copy = %q", got)
+	}
+	if _, ok := first["signature2"]; ok {
+		t.Errorf("signature2 = %v; defaults that are not bundled must be left out", first["signature2"])
+	}
+	if first["club_logo"] != "uploaded.svg" {
+		t.Errorf("club_logo = %v; files that are not bundled must be left alone", first["club_logo"])
+	}
+
+	if err := assets.DeleteAsset(first["template_name"].(string)); !errors.Is(err, ErrAssetInUse) {
+		t.Errorf("DeleteAsset of a version's copy error = %v, want ErrAssetInUse", err)
+	}
+
+	// Overlay layouts have no default images.
+	overlay := models.Template{Name: "overlay", Config: `{"template_name":"layout.json"}`, Version: 1}
+	if err := db.Create(&overlay).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.createTemplateVersion(db, &overlay); err != nil {
+		t.Fatal(err)
+	}
+	var overlayVersion models.TemplateVersion
+	if err := db.Where("template_id = ?", overlay.ID).First(&overlayVersion).Error; err != nil {
+		t.Fatal(err)
+	}
+	if overlayVersion.Files != "{}" {
+		t.Errorf("overlay version files = %s, want none", overlayVersion.Files)
+	}
+
+	// A template from before versioning renders its current config.
+	legacy := models.Template{Name: "legacy", Config: `{"template_name":"gala.html"}`, Version: 1}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	versioned, err := templateAtVersion(db, legacy, 0)
+	if err != nil || versioned.Config != legacy.Config {
+		t.Errorf("templateAtVersion of an unversioned template = %q, %v", versioned.Config, err)
+	}
+}
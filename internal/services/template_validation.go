@@ -0,0 +1,95 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"certificate-service/internal/models"
+	"certificate-service/pkg/pdf"
+)
+
+// templateImageKeys are the template config settings that name image files.
+var templateImageKeys = []string{
+	"side_design",
+	"org_logo",
+	"club_logo",
+	"signature1",
+	"signature2",
+	"signature3",
+	"signature4",
+}
+
+// templateFileKeys are the template config settings that name files.
+func templateFileKeys() []string {
+	return append([]string{"template_name"}, templateImageKeys...)
+}
+
+// TemplateValidationError lists every problem found with a template config,
+// so they can be fixed together.
+type TemplateValidationError struct {
+	Problems []pdf.TemplateProblem
+}
+
+func (e *TemplateValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "template has 1 problem"
+	}
+	return fmt.Sprintf("template has %d problems", len(e.Problems))
+}
+
+// validateConfig checks that a template config names an HTML template that
+// parses and only uses fields the generator provides, images that exist and
+// valid page settings, so that mistakes surface when the template is saved
+// instead of when its first certificates fail.
+func (s *TemplateService) validateConfig(config map[string]interface{}) error {
+	var problems []pdf.TemplateProblem
+
+	// File names are relative to the templates directory and may not leave
+	// it.
+	if value, ok := config["template_name"]; ok {
+		if name, ok := value.(string); !ok || !filepath.IsLocal(name) {
+			problems = append(problems, pdf.TemplateProblem{Field: "template_name", Message: "must be a file name"})
+		}
+	}
+	for _, key := range templateImageKeys {
+		if value, ok := config[key]; ok {
+			if name, ok := value.(string); !ok || (name != "" && !filepath.IsLocal(name)) {
+				problems = append(problems, pdf.TemplateProblem{Field: key, Message: "must be a file name"})
+			}
+		}
+	}
+
+	if value, ok := config["render_timeout"]; ok {
+		if seconds, ok := value.(float64); !ok || seconds <= 0 {
+			problems = append(problems, pdf.TemplateProblem{Field: "render_timeout", Message: "must be a positive number of seconds"})
+		}
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config format: %w", err)
+	}
+	templateName, data := renderData(models.Template{Config: string(configJSON)}, models.Recipient{}, "", "")
+
+	_, pageProblems := pdf.ParsePageSetup(data)
+	problems = append(problems, pageProblems...)
+
+	images := make(map[string]string)
+	for _, key := range templateImageKeys {
+		if name := data[key]; name != "" {
+			images[key] = name
+		}
+	}
+
+	found, err := s.pdfGen.ValidateTemplate(templateName, images)
+	if err != nil {
+		return fmt.Errorf("failed to validate template: %w", err)
+	}
+	problems = append(problems, found...)
+
+	if len(problems) > 0 {
+		return &TemplateValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"certificate-service/pkg/pdf"
+)
+
+func TestValidateConfigRejectsPathsOutsideTemplates(t *testing.T) {
+	root := t.TempDir()
+	templatesDir := filepath.Join(root, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(root, "config.yaml"):         `{"items": []}`,
+		filepath.Join(root, "secret.json"):         `{"items": []}`,
+		filepath.Join(templatesDir, "layout.json"): `{"items": [{"text": "{{.Name}}", "x": 10, "y": 20}]}`,
+		filepath.Join(templatesDir, "escape.json"): `{"background": "../secret.png", "items": [{"type": "image", "image": "../secret.png", "width": 10}, {"text": "x", "font": "../secret.ttf"}]}`,
+		filepath.Join(root, "secret.png"):          "not an image",
+	}
+	for path, data := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &TemplateService{pdfGen: pdf.NewRouter(nil, pdf.NewOverlayRenderer(templatesDir, nil))}
+
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+		// problems are the messages expected, in order; none means valid.
+		problems []string
+	}{
+		{
+			name:   "local layout",
+			config: map[string]interface{}{"template_name": "layout.json"},
+		},
+		{
+			name:     "parent directory",
+			config:   map[string]interface{}{"template_name": "../secret.json"},
+			problems: []string{"must be a file name", "template ../secret.json not found"},
+		},
+		{
+			name:     "nested parent directory",
+			config:   map[string]interface{}{"template_name": "../../config.yaml"},
+			problems: []string{"must be a file name", "HTML templates cannot be rendered while the browser is disabled"},
+		},
+		{
+			name:     "absolute path",
+			config:   map[string]interface{}{"template_name": filepath.Join(root, "secret.json")},
+			problems: []string{"must be a file name", "template " + filepath.Join(root, "secret.json") + " not found"},
+		},
+		{
+			name:     "image outside templates",
+			config:   map[string]interface{}{"template_name": "layout.json", "org_logo": "../secret.png"},
+			problems: []string{"must be a file name"},
+		},
+		{
+			name:   "empty image uses the default",
+			config: map[string]interface{}{"template_name": "layout.json", "org_logo": ""},
+		},
+		{
+			name:   "layout naming files outside templates",
+			config: map[string]interface{}{"template_name": "escape.json"},
+			problems: []string{
+				"background must be a file name",
+				"items[0]: image must be a file name",
+				"items[1]: font must be a file name",
+				"image ../secret.png not found",
+				"image ../secret.png not found",
+				"font ../secret.ttf not found",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.validateConfig(tt.config)
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Fatalf("validateConfig = %v, want no problems", err)
+				}
+				return
+			}
+
+			var validationErr *TemplateValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("validateConfig = %v, want a TemplateValidationError", err)
+			}
+			var got []string
+			for _, problem := range validationErr.Problems {
+				got = append(got, problem.Message)
+			}
+			if len(got) != len(tt.problems) {
+				t.Fatalf("problems = %q, want %q", got, tt.problems)
+			}
+			for i := range got {
+				if got[i] != tt.problems[i] {
+					t.Errorf("problem %d = %q, want %q", i, got[i], tt.problems[i])
+				}
+			}
+		})
+	}
+}
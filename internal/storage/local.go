@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type LocalStorage struct {
+	basePath string
+	signer   *URLSigner
+}
+
+// NewLocalStorage stores files under basePath. baseURL is the public address
+// of the route that serves signed files (see VerifySignedURL) and signingKey
+// is the HMAC key used for those links. The key is required: links are
+// emailed and must keep working across restarts and on every replica.
+func NewLocalStorage(basePath, baseURL, signingKey string) (*LocalStorage, error) {
+	if signingKey == "" {
+		return nil, ErrSigningKeyRequired
+	}
+	if basePath == "" {
+		basePath = "./storage/certificates"
+	}
+
+	absPath, err := filepath.Abs(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage path: %w", err)
+	}
+
+	if err := os.MkdirAll(absPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &LocalStorage{
+		basePath: absPath,
+		signer:   NewURLSigner(baseURL, signingKey),
+	}, nil
+}
+
+func (s *LocalStorage) Save(data []byte, event, name, email string) (string, error) {
+	dir, base, err := buildObjectName(event, name, email)
+	if err != nil {
+		return "", err
+	}
+
+	dirPath := filepath.Join(s.basePath, dir)
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmpPath, err := writeTemp(dirPath, data)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath)
+
+	return saveUnique(dir, base, func(key string) error {
+		return s.link(tmpPath, key)
+	})
+}
+
+// link stores the written file tmpPath at key. It links instead of renaming
+// so an existing certificate is never overwritten: the link fails with
+// ErrExists.
+func (s *LocalStorage) link(tmpPath, key string) error {
+	fullPath, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Link(tmpPath, fullPath)
+	if errors.Is(err, fs.ErrExist) {
+		return ErrExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Put(path string, data []byte) error {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	dirPath := filepath.Dir(fullPath)
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmpPath, err := writeTemp(dirPath, data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if err := os.Rename(tmpPath, fullPath); err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	return nil
+}
+
+// writeTemp writes data to a new temporary file in dirPath, so it can be
+// moved into place complete.
+func writeTemp(dirPath string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(dirPath, ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to close file: %w", err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to set file permissions: %w", err)
+	}
+	return tmpPath, nil
+}
+
+func (s *LocalStorage) Get(path string) ([]byte, error) {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(fullPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return data, nil
+}
+
+func (s *LocalStorage) Delete(path string) error {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(fullPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *LocalStorage) Exists(path string) (bool, error) {
+	_, err := s.Stat(path)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *LocalStorage) Stat(path string) (*FileInfo, error) {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(fullPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, ErrNotFound
+	}
+
+	key, _ := cleanKey(path)
+	return &FileInfo{
+		Path:    key,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStorage) List(prefix string) ([]FileInfo, error) {
+	root := s.basePath
+	if prefix != "" {
+		resolved, err := s.resolve(prefix)
+		if err != nil {
+			return nil, err
+		}
+		root = resolved
+	}
+
+	var files []FileInfo
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.basePath, p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, FileInfo{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+func (s *LocalStorage) SignedURL(path string, expiry time.Duration) (string, error) {
+	return s.signer.Sign(path, time.Now().Add(expiry))
+}
+
+func (s *LocalStorage) VerifySignedURL(path, expires, signature string) error {
+	return s.signer.Verify(path, expires, signature)
+}
+
+// LocalPath returns the absolute filesystem path of a stored file so it can
+// be streamed with http.ServeContent instead of being read into memory.
+func (s *LocalStorage) LocalPath(path string) (string, error) {
+	if _, err := s.Stat(path); err != nil {
+		return "", err
+	}
+	return s.resolve(path)
+}
+
+func (s *LocalStorage) resolve(path string) (string, error) {
+	key, err := cleanKey(path)
+	if err != nil {
+		return "", err
+	}
+
+	fullPath := filepath.Join(s.basePath, filepath.FromSlash(key))
+	if fullPath != s.basePath && !strings.HasPrefix(fullPath, s.basePath+string(filepath.Separator)) {
+		return "", ErrInvalidPath
+	}
+
+	return fullPath, nil
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestLocalStorage(t *testing.T) *LocalStorage {
+	t.Helper()
+	s, err := NewLocalStorage(filepath.Join(t.TempDir(), "certificates"), "http://localhost/files", "test-key")
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	return s
+}
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "event/name.pdf", want: "event/name.pdf"},
+		{key: "/event/name.pdf", want: "event/name.pdf"},
+		{key: "event//./name.pdf", want: "event/name.pdf"},
+		{key: `event\name.pdf`, want: "event/name.pdf"},
+		{key: "", wantErr: true},
+		{key: "..", wantErr: true},
+		{key: "../name.pdf", wantErr: true},
+		{key: "event/../../name.pdf", wantErr: true},
+		{key: `event\..\..\name.pdf`, wantErr: true},
+		{key: "/../etc/passwd", wantErr: true},
+		{key: "event/name\x00.pdf", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := cleanKey(tt.key)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidPath) {
+				t.Errorf("cleanKey(%q) = %q, %v; want ErrInvalidPath", tt.key, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("cleanKey(%q) = %q, %v; want %q", tt.key, got, err, tt.want)
+		}
+	}
+}
+
+func TestLocalStorageRejectsTraversal(t *testing.T) {
+	s := newTestLocalStorage(t)
+	outside := filepath.Join(filepath.Dir(s.basePath), "outside.pdf")
+	if err := os.WriteFile(outside, []byte("outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	key := "../outside.pdf"
+	checks := map[string]error{
+		"Put":    s.Put(key, []byte("overwritten")),
+		"Delete": s.Delete(key),
+	}
+	_, checks["Get"] = s.Get(key)
+	_, checks["Exists"] = s.Exists(key)
+	_, checks["Stat"] = s.Stat(key)
+	_, checks["List"] = s.List("..")
+	_, checks["LocalPath"] = s.LocalPath(key)
+	_, checks["SignedURL"] = s.SignedURL(key, 0)
+	checks["VerifySignedURL"] = s.VerifySignedURL(key, "0", "")
+	_, checks["Save"] = s.Save([]byte("x"), "event", "../name", "someone@example.com")
+
+	for method, err := range checks {
+		if !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%s(%q) error = %v, want ErrInvalidPath", method, key, err)
+		}
+	}
+
+	data, err := os.ReadFile(outside)
+	if err != nil || string(data) != "outside" {
+		t.Errorf("file outside the storage root was changed: %q, %v", data, err)
+	}
+}
+
+func TestLocalStorageSaveDoesNotOverwrite(t *testing.T) {
+	s := newTestLocalStorage(t)
+
+	first, err := s.Save([]byte("first"), "Spring Meetup", "Ada Lovelace", "ada@example.com")
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	second, err := s.Save([]byte("second"), "Spring Meetup", "Ada Lovelace", "ada@example.com")
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if !strings.HasPrefix(first, "spring-meetup/ada-lovelace_") || !strings.HasSuffix(first, ".pdf") {
+		t.Errorf("first key = %q", first)
+	}
+	if want := strings.TrimSuffix(first, ".pdf") + "-1.pdf"; second != want {
+		t.Errorf("second key = %q, want %q", second, want)
+	}
+
+	for key, want := range map[string]string{first: "first", second: "second"} {
+		data, err := s.Get(key)
+		if err != nil || string(data) != want {
+			t.Errorf("Get(%q) = %q, %v; want %q", key, data, err, want)
+		}
+	}
+
+	tmpPath, err := writeTemp(s.basePath, []byte("third"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpPath)
+	if err := s.link(tmpPath, first); !errors.Is(err, ErrExists) {
+		t.Errorf("link onto %q error = %v, want ErrExists", first, err)
+	}
+
+	files, err := s.List("")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("List = %v, want the two saved files", files)
+	}
+}
+
+func TestLocalStoragePutOverwrites(t *testing.T) {
+	s := newTestLocalStorage(t)
+	key := "event/name.png"
+
+	for _, data := range []string{"first", "second"} {
+		if err := s.Put(key, []byte(data)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	data, err := s.Get(key)
+	if err != nil || string(data) != "second" {
+		t.Errorf("Get(%q) = %q, %v; want %q", key, data, err, "second")
+	}
+
+	files, err := s.List("event")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != key || files[0].Size != int64(len("second")) {
+		t.Errorf("List = %v, want only %s", files, key)
+	}
+}
@@ -0,0 +1,348 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+type S3Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	PathStyle bool
+}
+
+type S3Storage struct {
+	client  *minio.Client
+	bucket  string
+	prefix  string
+	timeout time.Duration
+}
+
+func NewS3Storage(opts S3Options) (*S3Storage, error) {
+	s, err := newS3Client(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	exists, err := s.client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check s3 bucket: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("s3 bucket %q does not exist", opts.Bucket)
+	}
+
+	return s, nil
+}
+
+// newS3Client creates an S3Storage without checking that its bucket exists.
+func newS3Client(opts S3Options) (*S3Storage, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+		if opts.Region != "" && opts.Region != "us-east-1" {
+			endpoint = fmt.Sprintf("s3.%s.amazonaws.com", opts.Region)
+		}
+	}
+	// minio-go wants a bare host:port; accept URLs in config for convenience.
+	if strings.HasPrefix(endpoint, "http://") {
+		opts.UseSSL = false
+	}
+	endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "https://"), "http://")
+	endpoint = strings.TrimRight(endpoint, "/")
+
+	var creds *credentials.Credentials
+	if opts.AccessKey != "" {
+		creds = credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, "")
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		})
+	}
+
+	lookup := minio.BucketLookupAuto
+	if opts.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       opts.UseSSL,
+		Region:       opts.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	return &S3Storage{
+		client:  client,
+		bucket:  opts.Bucket,
+		prefix:  strings.Trim(opts.Prefix, "/"),
+		timeout: 30 * time.Second,
+	}, nil
+}
+
+func (s *S3Storage) Save(data []byte, event, name, email string) (string, error) {
+	dir, base, err := buildObjectName(event, name, email)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	return saveUnique(dir, base, func(key string) error {
+		// Check first to avoid uploading the file only to have it refused.
+		exists, err := s.exists(ctx, key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrExists
+		}
+		return s.create(ctx, key, data)
+	})
+}
+
+// create uploads a new certificate to key. If-None-Match makes the upload
+// fail with ErrExists if another replica wrote the key after it was checked.
+func (s *S3Storage) create(ctx context.Context, key string, data []byte) error {
+	opts := minio.PutObjectOptions{ContentType: "application/pdf"}
+	opts.SetMatchETagExcept("*")
+
+	_, err := s.client.PutObject(ctx, s.bucket, s.objectKey(key), bytes.NewReader(data), int64(len(data)), opts)
+	if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+		return ErrExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) Put(path string, data []byte) error {
+	key, err := cleanKey(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	contentType := mime.TypeByExtension(pathpkg.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	_, err = s.client.PutObject(ctx, s.bucket, s.objectKey(key), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) Get(path string) ([]byte, error) {
+	key, err := cleanKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	obj, err := s.client.GetObject(ctx, s.bucket, s.objectKey(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.wrapError("failed to get file", err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, s.wrapError("failed to read file", err)
+	}
+
+	return data, nil
+}
+
+func (s *S3Storage) Delete(path string) error {
+	key, err := cleanKey(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	exists, err := s.exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	if err := s.client.RemoveObject(ctx, s.bucket, s.objectKey(key), minio.RemoveObjectOptions{}); err != nil {
+		return s.wrapError("failed to delete file", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) Exists(path string) (bool, error) {
+	key, err := cleanKey(path)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	return s.exists(ctx, key)
+}
+
+func (s *S3Storage) Stat(path string) (*FileInfo, error) {
+	key, err := cleanKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	info, err := s.client.StatObject(ctx, s.bucket, s.objectKey(key), minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s.wrapError("failed to stat file", err)
+	}
+
+	return &FileInfo{
+		Path:    key,
+		Size:    info.Size,
+		ModTime: info.LastModified,
+	}, nil
+}
+
+func (s *S3Storage) List(prefix string) ([]FileInfo, error) {
+	listPrefix := s.prefix
+	if prefix != "" {
+		key, err := cleanKey(prefix)
+		if err != nil {
+			return nil, err
+		}
+		listPrefix = s.objectKey(key)
+	}
+	if listPrefix != "" && !strings.HasSuffix(listPrefix, "/") {
+		listPrefix += "/"
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	var files []FileInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    listPrefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", obj.Err)
+		}
+		files = append(files, FileInfo{
+			Path:    strings.TrimPrefix(strings.TrimPrefix(obj.Key, s.prefix), "/"),
+			Size:    obj.Size,
+			ModTime: obj.LastModified,
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+func (s *S3Storage) SignedURL(path string, expiry time.Duration) (string, error) {
+	key, err := cleanKey(path)
+	if err != nil {
+		return "", err
+	}
+
+	// SigV4 presigned URLs cannot outlive seven days.
+	if expiry > maxPresignExpiry {
+		expiry = maxPresignExpiry
+	}
+
+	params := url.Values{}
+	params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", pathpkg.Base(key)))
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, s.objectKey(key), expiry, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign url: %w", err)
+	}
+
+	return u.String(), nil
+}
+
+func (s *S3Storage) exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.StatObject(ctx, s.bucket, s.objectKey(key), minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if isS3NotFound(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to stat file: %w", err)
+}
+
+func (s *S3Storage) objectKey(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return s.prefix + "/" + key
+}
+
+func (s *S3Storage) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.timeout)
+}
+
+func (s *S3Storage) wrapError(msg string, err error) error {
+	if isS3NotFound(err) {
+		return ErrNotFound
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+func isS3NotFound(err error) bool {
+	resp := minio.ToErrorResponse(err)
+	return resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound
+}
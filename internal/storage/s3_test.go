@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// newTestS3Storage connects to the S3-compatible server at S3_TEST_ENDPOINT,
+// such as a local MinIO (see the README), and skips the test when it is not
+// set. Each test gets its own key prefix in S3_TEST_BUCKET, which is created
+// if missing and emptied afterwards.
+func newTestS3Storage(t *testing.T) *S3Storage {
+	t.Helper()
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	bucket := os.Getenv("S3_TEST_BUCKET")
+	if bucket == "" {
+		bucket = "certificates-test"
+	}
+
+	opts := S3Options{
+		Endpoint:  endpoint,
+		Region:    os.Getenv("S3_TEST_REGION"),
+		Bucket:    bucket,
+		Prefix:    fmt.Sprintf("test-%d", time.Now().UnixNano()),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		UseSSL:    strings.HasPrefix(endpoint, "https://"),
+		PathStyle: true,
+	}
+
+	client, err := newS3Client(opts)
+	if err != nil {
+		t.Fatalf("newS3Client: %v", err)
+	}
+	ctx, cancel := client.context()
+	defer cancel()
+	exists, err := client.client.BucketExists(ctx, bucket)
+	if err != nil {
+		t.Fatalf("failed to connect to %s: %v", endpoint, err)
+	}
+	if !exists {
+		if err := client.client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: opts.Region}); err != nil {
+			t.Fatalf("failed to create bucket %s: %v", bucket, err)
+		}
+	}
+
+	t.Cleanup(func() {
+		files, err := client.List("")
+		if err != nil {
+			t.Logf("failed to list test files: %v", err)
+			return
+		}
+		for _, file := range files {
+			client.Delete(file.Path)
+		}
+	})
+	return client
+}
+
+func TestS3Storage(t *testing.T) {
+	s := newTestS3Storage(t)
+
+	first, err := s.Save([]byte("first"), "Spring Meetup", "Ada Lovelace", "ada@example.com")
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	second, err := s.Save([]byte("second"), "Spring Meetup", "Ada Lovelace", "ada@example.com")
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// The keys must match what LocalStorage would choose.
+	local := newTestLocalStorage(t)
+	for _, want := range []string{first, second} {
+		got, err := local.Save([]byte("x"), "Spring Meetup", "Ada Lovelace", "ada@example.com")
+		if err != nil || got != want {
+			t.Errorf("LocalStorage.Save = %q, %v; S3Storage.Save = %q", got, err, want)
+		}
+	}
+
+	for key, want := range map[string]string{first: "first", second: "second"} {
+		data, err := s.Get(key)
+		if err != nil || string(data) != want {
+			t.Errorf("Get(%q) = %q, %v; want %q", key, data, err, want)
+		}
+	}
+
+	// A write racing the existence check is refused by If-None-Match with
+	// the error LocalStorage gives for the same collision.
+	ctx, cancel := s.context()
+	defer cancel()
+	if err := s.create(ctx, first, []byte("third")); !errors.Is(err, ErrExists) {
+		t.Errorf("create over %q error = %v, want ErrExists", first, err)
+	}
+	if data, err := s.Get(first); err != nil || string(data) != "first" {
+		t.Errorf("Get(%q) after refused create = %q, %v; want %q", first, data, err, "first")
+	}
+
+	image := "spring-meetup/image.png"
+	for _, data := range []string{"first", "second"} {
+		if err := s.Put(image, []byte(data)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	if data, err := s.Get(image); err != nil || string(data) != "second" {
+		t.Errorf("Get(%q) = %q, %v; want %q", image, data, err, "second")
+	}
+
+	info, err := s.Stat(image)
+	if err != nil || info.Path != image || info.Size != int64(len("second")) {
+		t.Errorf("Stat(%q) = %+v, %v", image, info, err)
+	}
+
+	files, err := s.List("spring-meetup")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	want := []string{first, second, image}
+	sort.Strings(want)
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("List = %v, want %v", paths, want)
+	}
+
+	url, err := s.SignedURL(first, time.Minute)
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET signed url: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "first" {
+		t.Errorf("GET signed url = %d %q, want 200 %q", resp.StatusCode, body, "first")
+	}
+	if disposition := resp.Header.Get("Content-Disposition"); !strings.Contains(disposition, "attachment") {
+		t.Errorf("Content-Disposition = %q, want an attachment", disposition)
+	}
+
+	if err := s.Delete(second); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if exists, err := s.Exists(second); err != nil || exists {
+		t.Errorf("Exists(%q) after Delete = %v, %v", second, exists, err)
+	}
+	if exists, err := s.Exists(first); err != nil || !exists {
+		t.Errorf("Exists(%q) = %v, %v", first, exists, err)
+	}
+	if err := s.Delete(second); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Get(second); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of deleted file error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Stat(second); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of deleted file error = %v, want ErrNotFound", err)
+	}
+
+	if _, err := s.Get("../" + first); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Get outside the prefix error = %v, want ErrInvalidPath", err)
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := NewURLSigner("http://localhost/files/", "test-key")
+	path := "spring meetup/ada_0123456789.pdf"
+
+	signed, err := signer.Sign(path, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if !strings.HasPrefix(signed, "http://localhost/files/spring%20meetup/ada_0123456789.pdf?") {
+		t.Errorf("Sign = %q", signed)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+
+	expired, err := signer.Sign(path, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	expiredURL, _ := url.Parse(expired)
+
+	tests := []struct {
+		name      string
+		signer    *URLSigner
+		path      string
+		expires   string
+		signature string
+		want      error
+	}{
+		{name: "valid", path: path, expires: expires, signature: signature},
+		{name: "same file, uncleaned path", path: "/" + path, expires: expires, signature: signature},
+		{name: "expired", path: path, expires: expiredURL.Query().Get("expires"), signature: expiredURL.Query().Get("signature"), want: ErrSignatureExpired},
+		{name: "expiry extended", path: path, expires: expiredURL.Query().Get("expires") + "0", signature: expiredURL.Query().Get("signature"), want: ErrSignatureInvalid},
+		{name: "other file", path: "spring meetup/grace_0123456789.pdf", expires: expires, signature: signature, want: ErrSignatureInvalid},
+		{name: "tampered signature", path: path, expires: expires, signature: signature[:len(signature)-1] + "x", want: ErrSignatureInvalid},
+		{name: "no signature", path: path, expires: expires, want: ErrSignatureInvalid},
+		{name: "expires not a number", path: path, expires: "soon", signature: signature, want: ErrSignatureInvalid},
+		{name: "other key", signer: NewURLSigner("http://localhost/files", "other-key"), path: path, expires: expires, signature: signature, want: ErrSignatureInvalid},
+		{name: "traversal", path: "../" + path, expires: expires, signature: signature, want: ErrInvalidPath},
+	}
+	for _, tt := range tests {
+		verifier := signer
+		if tt.signer != nil {
+			verifier = tt.signer
+		}
+		err := verifier.Verify(tt.path, tt.expires, tt.signature)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: Verify = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNewLocalStorageRequiresSigningKey(t *testing.T) {
+	if _, err := NewLocalStorage(t.TempDir(), "http://localhost/files", ""); !errors.Is(err, ErrSigningKeyRequired) {
+		t.Errorf("NewLocalStorage without a key = %v, want ErrSigningKeyRequired", err)
+	}
+}
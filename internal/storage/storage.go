@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrNotFound    = errors.New("file not found")
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrExists is returned when a new file would replace one already stored.
+	ErrExists = errors.New("file already exists")
+)
+
+// maxNameCollisions bounds how many numbered names Save tries for one
+// certificate.
+const maxNameCollisions = 1000
+
+// Storage keeps certificate files. Save stores a new certificate PDF under a
+// name of its own; Put writes a file at a given path, replacing any file
+// already there, for files that belong with a saved certificate.
+type Storage interface {
+	Save(data []byte, event, name, email string) (string, error)
+	Put(path string, data []byte) error
+	Get(path string) ([]byte, error)
+	Delete(path string) error
+	Exists(path string) (bool, error)
+	List(prefix string) ([]FileInfo, error)
+	Stat(path string) (*FileInfo, error)
+	SignedURL(path string, expiry time.Duration) (string, error)
+}
+
+type FileInfo struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func Slugify(s string) string {
+	var b strings.Builder
+	lastDash := true
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			lastDash = false
+		case !lastDash:
+			b.WriteByte('-')
+			lastDash = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+func validateComponent(field, value string) error {
+	if strings.ContainsAny(value, "/\\\x00") || strings.Contains(value, "..") {
+		return fmt.Errorf("%w: %s contains path separators", ErrInvalidPath, field)
+	}
+	return nil
+}
+
+// buildObjectName returns the event directory and base file name (without
+// extension) for a certificate. The email hash keeps recipients that share a
+// name apart without leaking the address into the path.
+func buildObjectName(event, name, email string) (string, string, error) {
+	if err := validateComponent("name", name); err != nil {
+		return "", "", err
+	}
+	if err := validateComponent("email", email); err != nil {
+		return "", "", err
+	}
+
+	dir := Slugify(event)
+	if dir == "" {
+		dir = "default"
+	}
+
+	base := Slugify(name)
+	if base == "" {
+		base = "certificate"
+	}
+
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return dir, fmt.Sprintf("%s_%s", base, hex.EncodeToString(sum[:])[:10]), nil
+}
+
+// saveUnique stores a new certificate at dir/base.pdf, or at base-1.pdf,
+// base-2.pdf and so on when that name is taken. create must fail with
+// ErrExists instead of replacing an existing file.
+func saveUnique(dir, base string, create func(key string) error) (string, error) {
+	for i := 0; i < maxNameCollisions; i++ {
+		filename := base + ".pdf"
+		if i > 0 {
+			filename = fmt.Sprintf("%s-%d.pdf", base, i)
+		}
+		key := dir + "/" + filename
+
+		err := create(key)
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, ErrExists) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("failed to store file: too many name collisions for %s", base)
+}
+
+// cleanKey normalizes a storage-relative path and rejects anything that would
+// escape the storage root.
+func cleanKey(p string) (string, error) {
+	p = strings.TrimPrefix(strings.ReplaceAll(p, "\\", "/"), "/")
+	if p == "" || strings.ContainsRune(p, 0) {
+		return "", ErrInvalidPath
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return "", ErrInvalidPath
+		}
+	}
+	return path.Clean(p), nil
+}
@@ -0,0 +1,19 @@
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS code VARCHAR(32);
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS issued_at TIMESTAMP;
+
+-- Same alphabet and length as models.NewCertificateCode, drawn from
+-- gen_random_bytes. The subquery refers to c.id so it runs once per row.
+UPDATE certificates c
+SET code = (
+    SELECT string_agg(substr('23456789ABCDEFGHJKLMNPQRSTUVWXYZ', get_byte(r.bytes, i) % 32 + 1, 1), '' ORDER BY i)
+    FROM (SELECT gen_random_bytes(12) AS bytes WHERE c.id IS NOT NULL) r, generate_series(0, 11) AS i
+)
+WHERE code IS NULL OR code = '';
+
+UPDATE certificates
+SET issued_at = updated_at
+WHERE issued_at IS NULL AND status = 'completed';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_certificates_code ON certificates(code);
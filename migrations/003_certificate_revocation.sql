@@ -0,0 +1,7 @@
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP;
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS revocation_reason TEXT;
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS replaces_id INTEGER REFERENCES certificates(id);
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS superseded_by_id INTEGER REFERENCES certificates(id);
+
+CREATE INDEX IF NOT EXISTS idx_certificates_replaces_id ON certificates(replaces_id);
+CREATE INDEX IF NOT EXISTS idx_certificates_superseded_by_id ON certificates(superseded_by_id);
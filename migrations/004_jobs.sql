@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id VARCHAR(255) PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    certificate_id INTEGER,
+    batch_id INTEGER,
+    worker_id VARCHAR(255),
+    attempts INTEGER DEFAULT 0,
+    last_error TEXT,
+    queued_at TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    next_retry_at TIMESTAMP,
+    wait_ms BIGINT DEFAULT 0,
+    run_ms BIGINT DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_type ON jobs(type);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+CREATE INDEX IF NOT EXISTS idx_jobs_certificate_id ON jobs(certificate_id);
+CREATE INDEX IF NOT EXISTS idx_jobs_batch_id ON jobs(batch_id);
@@ -0,0 +1,5 @@
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS batch_id INTEGER REFERENCES certificate_batches(id);
+ALTER TABLE certificate_batches ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP;
+ALTER TABLE certificate_batches ADD COLUMN IF NOT EXISTS metadata JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_certificates_batch_id ON certificates(batch_id);
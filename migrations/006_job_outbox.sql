@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS job_outbox (
+    id SERIAL PRIMARY KEY,
+    job_id VARCHAR(255) NOT NULL UNIQUE,
+    batch_id INTEGER,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_outbox_batch_id ON job_outbox(batch_id);
@@ -0,0 +1,9 @@
+-- dedup_key is only set for certificates issued from now on; existing rows
+-- may already contain duplicates and are left out of the rule.
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS dedup_key VARCHAR(64);
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+ALTER TABLE certificate_batches ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_certificates_dedup_key ON certificates(dedup_key);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_certificates_idempotency_key ON certificates(idempotency_key);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_certificate_batches_idempotency_key ON certificate_batches(idempotency_key);
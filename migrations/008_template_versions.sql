@@ -0,0 +1,40 @@
+ALTER TABLE templates ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE email_templates ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS template_versions (
+    id SERIAL PRIMARY KEY,
+    template_id INTEGER NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    config JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_template_versions_template_version ON template_versions(template_id, version);
+
+CREATE TABLE IF NOT EXISTS email_template_versions (
+    id SERIAL PRIMARY KEY,
+    email_template_id INTEGER NOT NULL REFERENCES email_templates(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    subject VARCHAR(500) NOT NULL,
+    body_html TEXT NOT NULL,
+    body_text TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_template_versions_template_version ON email_template_versions(email_template_id, version);
+
+-- Every existing template becomes version 1, which is what existing
+-- certificates were rendered with.
+INSERT INTO template_versions (template_id, version, config, created_at)
+SELECT id, 1, config, created_at FROM templates
+ON CONFLICT (template_id, version) DO NOTHING;
+
+INSERT INTO email_template_versions (email_template_id, version, subject, body_html, body_text, created_at)
+SELECT id, 1, subject, body_html, body_text, created_at FROM email_templates
+ON CONFLICT (email_template_id, version) DO NOTHING;
+
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS template_version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS email_template_id INTEGER REFERENCES email_templates(id);
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS email_template_version INTEGER NOT NULL DEFAULT 0;
+
+UPDATE certificates SET template_version = 1 WHERE template_version = 0;
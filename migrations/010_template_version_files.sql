@@ -0,0 +1,3 @@
+-- Copies of the bundled files each template version names, keyed by file
+-- name. Versions created before this keep reading the files from disk.
+ALTER TABLE template_versions ADD COLUMN IF NOT EXISTS files JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,19 @@
+-- Revoked and superseded certificates were counted as failed; they get a
+-- count of their own so revoking a delivered certificate does not fail its
+-- batch after the fact.
+ALTER TABLE certificate_batches ADD COLUMN IF NOT EXISTS revoked INTEGER NOT NULL DEFAULT 0;
+
+UPDATE certificate_batches b
+SET revoked = r.count,
+    failed = GREATEST(b.failed - r.count, 0)
+FROM (
+    SELECT batch_id, COUNT(*) AS count
+    FROM certificates
+    WHERE batch_id IS NOT NULL AND status IN ('revoked', 'superseded')
+    GROUP BY batch_id
+) r
+WHERE b.id = r.batch_id AND b.revoked = 0;
+
+UPDATE certificate_batches
+SET status = CASE WHEN failed > 0 AND failed >= total_count - revoked THEN 'failed' ELSE 'completed' END
+WHERE status IN ('completed', 'failed');
@@ -0,0 +1,176 @@
+package pdf
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// TemplateFields returns the names of the CertificateData fields a template
+// prints unconditionally, such as "Name" or "Course", in sorted order. Meta
+// values are named by key, as "Meta.team". Fields only used inside
+// {{if .X}} or {{with .X}} for that same field are left out, since the
+// template already copes with them being empty.
+func (g *HTMLGenerator) TemplateFields(templateName string) ([]string, error) {
+	tmpl, err := g.parseTemplate(templateName)
+	if err != nil {
+		return nil, err
+	}
+	return walkTemplate(tmpl).printedFields(), nil
+}
+
+// rangeElement stands for the element of a ranged-over field in a field
+// chain, as in "Meta.*" for {{range .Meta}}{{.}}{{end}}.
+const rangeElement = "*"
+
+// fieldWalker collects the CertificateData fields a template refers to. It
+// follows what dot stands for through {{with}} and {{range}}, so that
+// {{with .Meta}}{{.team}}{{end}} uses Meta.team.
+type fieldWalker struct {
+	// used holds every field chain the template refers to, joined with
+	// dots.
+	used map[string]bool
+	// printed holds the fields, named as by fieldKey, used outside an
+	// {{if}}, {{with}} or {{range}} that tests them.
+	printed map[string]bool
+}
+
+// walkTemplate walks every template defined in tmpl, with dot standing for
+// CertificateData.
+func walkTemplate(tmpl *template.Template) *fieldWalker {
+	w := &fieldWalker{used: make(map[string]bool), printed: make(map[string]bool)}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			w.walk(t.Tree.Root, []string{}, nil)
+		}
+	}
+	return w
+}
+
+func (w *fieldWalker) printedFields() []string {
+	fields := make([]string, 0, len(w.printed))
+	for field := range w.printed {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// walk records the fields used under node. dot is the field chain dot
+// stands for, empty for CertificateData itself and nil when it is not a
+// field; guarded holds the fields tested by enclosing conditions.
+func (w *fieldWalker) walk(node parse.Node, dot []string, guarded map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			w.walk(child, dot, guarded)
+		}
+	case *parse.ActionNode:
+		w.walk(n.Pipe, dot, guarded)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			w.walk(cmd, dot, guarded)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			w.walk(arg, dot, guarded)
+		}
+	case *parse.FieldNode:
+		if dot != nil {
+			w.record(join(dot, n.Ident), guarded)
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			w.record(n.Ident[1:], guarded)
+		}
+	case *parse.ChainNode:
+		w.walk(n.Node, dot, guarded)
+	case *parse.IfNode:
+		w.walkBranch(&n.BranchNode, dot, dot, guarded)
+	case *parse.WithNode:
+		w.walkBranch(&n.BranchNode, dot, pipeChain(n.Pipe, dot), guarded)
+	case *parse.RangeNode:
+		var element []string
+		if chain := pipeChain(n.Pipe, dot); chain != nil {
+			element = join(chain, []string{rangeElement})
+		}
+		w.walkBranch(&n.BranchNode, dot, element, guarded)
+	case *parse.TemplateNode:
+		w.walk(n.Pipe, dot, guarded)
+	}
+}
+
+// walkBranch walks an if, with or range: the fields its pipeline tests are
+// guarded inside its body, where dot stands for inner, while its else branch
+// keeps the outer dot.
+func (w *fieldWalker) walkBranch(n *parse.BranchNode, dot, inner []string, guarded map[string]bool) {
+	condition := &fieldWalker{used: w.used, printed: make(map[string]bool)}
+	condition.walk(n.Pipe, dot, nil)
+
+	innerGuarded := make(map[string]bool, len(guarded)+len(condition.printed))
+	for field := range guarded {
+		innerGuarded[field] = true
+	}
+	for field := range condition.printed {
+		innerGuarded[field] = true
+	}
+
+	w.walk(n.List, inner, innerGuarded)
+	w.walk(n.ElseList, dot, guarded)
+}
+
+func (w *fieldWalker) record(chain []string, guarded map[string]bool) {
+	if len(chain) == 0 {
+		return
+	}
+	w.used[strings.Join(chain, ".")] = true
+	if key := fieldKey(chain); !guarded[key] && !strings.Contains(key, rangeElement) {
+		w.printed[key] = true
+	}
+}
+
+// pipeChain returns the field chain a pipeline evaluates to when it is just
+// a field, $ or dot, and nil otherwise.
+func pipeChain(pipe *parse.PipeNode, dot []string) []string {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return nil
+	}
+	switch n := pipe.Cmds[0].Args[0].(type) {
+	case *parse.FieldNode:
+		if dot != nil {
+			return join(dot, n.Ident)
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" {
+			return join(nil, n.Ident[1:])
+		}
+	case *parse.DotNode:
+		return dot
+	}
+	return nil
+}
+
+// join returns a new chain of prefix followed by ident.
+func join(prefix, ident []string) []string {
+	chain := make([]string, 0, len(prefix)+len(ident))
+	return append(append(chain, prefix...), ident...)
+}
+
+// fieldKey names the CertificateData field an identifier chain refers to,
+// keeping the key for Meta lookups.
+func fieldKey(ident []string) string {
+	if len(ident) == 0 {
+		return ""
+	}
+	if ident[0] == "Meta" && len(ident) > 1 {
+		return "Meta." + ident[1]
+	}
+	return ident[0]
+}
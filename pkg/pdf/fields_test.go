@@ -0,0 +1,108 @@
+package pdf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTemplateFieldsAndValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		printed  []string
+		problems []TemplateProblem
+	}{
+		{
+			name:     "top-level fields",
+			template: `{{.Name}} {{.Meta.team}} {{$.Course}}`,
+			printed:  []string{"Course", "Meta.team", "Name"},
+		},
+		{
+			name:     "if guards the field it tests",
+			template: `{{if .Course}}{{.Course}}{{end}} {{if .Club}}{{.Name}}{{else}}{{.Club}}{{end}}`,
+			printed:  []string{"Club", "Name"},
+		},
+		{
+			name:     "with rebinds dot",
+			template: `{{with .Meta}}{{.team}}{{end}}`,
+			printed:  []string{"Meta.team"},
+		},
+		{
+			name:     "with guards its own field",
+			template: `{{with .Meta.team}}Team {{.}}{{end}}`,
+			printed:  []string{},
+		},
+		{
+			name:     "else keeps the outer dot",
+			template: `{{with .Meta.team}}{{.}}{{else}}{{.Name}}{{end}}`,
+			printed:  []string{"Name"},
+		},
+		{
+			name:     "$ inside with",
+			template: `{{with .Meta}}{{.team}} {{$.Event}}{{end}}`,
+			printed:  []string{"Event", "Meta.team"},
+		},
+		{
+			name:     "nested with",
+			template: `{{with .Meta}}{{with .team}}{{.}}{{end}}{{end}}`,
+			printed:  []string{},
+		},
+		{
+			name:     "range over Meta",
+			template: `{{range $key, $value := .Meta}}{{$key}}: {{.}}{{end}}`,
+			printed:  []string{},
+		},
+		{
+			name:     "unknown field",
+			template: `{{.Nmae}}`,
+			printed:  []string{"Nmae"},
+			problems: []TemplateProblem{{Field: "Nmae", Message: "is not a field the generator provides"}},
+		},
+		{
+			name:     "unknown field inside with",
+			template: `{{with .Meta}}{{.team}}{{end}}{{with .Name}}{{.First}}{{end}}`,
+			printed:  []string{"Meta.team"},
+			problems: []TemplateProblem{{Field: "Name.First", Message: "Name is text and has no field First"}},
+		},
+		{
+			name:     "field of a Meta value",
+			template: `{{range .Meta}}{{.team}}{{end}}`,
+			printed:  []string{},
+			problems: []TemplateProblem{{Field: "Meta.*.team", Message: "Meta values are text and have no fields"}},
+		},
+		{
+			// Fields of other values are left to the trial run.
+			name:     "field of a function result",
+			template: `{{with printf "%s" .Name}}{{.Anything}}{{end}}`,
+			printed:  []string{},
+			problems: []TemplateProblem{{
+				Field:   "template_name",
+				Message: `template: certificate.html:1:28: executing "certificate.html" at <.Anything>: can't evaluate field Anything in type string`,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &HTMLGenerator{templateSource: templateSource{
+				templatesDir: t.TempDir(),
+				assets:       testAssets{"certificate.html": tt.template},
+			}}
+
+			printed, err := g.TemplateFields("certificate.html")
+			if err != nil {
+				t.Fatalf("TemplateFields: %v", err)
+			}
+			if !reflect.DeepEqual(printed, tt.printed) {
+				t.Errorf("TemplateFields = %q, want %q", printed, tt.printed)
+			}
+
+			problems, err := g.ValidateTemplate("certificate.html", nil)
+			if err != nil {
+				t.Fatalf("ValidateTemplate: %v", err)
+			}
+			if !reflect.DeepEqual(problems, tt.problems) {
+				t.Errorf("ValidateTemplate = %+v, want %+v", problems, tt.problems)
+			}
+		})
+	}
+}
@@ -2,22 +2,51 @@ package pdf
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/launcher"
 	"github.com/go-rod/rod/lib/proto"
 )
 
-type HTMLGenerator struct {
+var (
+	// ErrInvalidTemplate marks render failures caused by the template
+	// itself, which fail the same way on every attempt.
+	ErrInvalidTemplate = errors.New("invalid template")
+	// ErrRenderTimeout is returned when a render takes longer than its
+	// timeout.
+	ErrRenderTimeout = errors.New("render timed out")
+)
+
+const maxRenderTimeout = 5 * time.Minute
+
+// AssetStore supplies templates and images that are not bundled under the
+// templates directory, such as ones uploaded at runtime. Asset reports
+// ok=false when it has nothing under that name.
+type AssetStore interface {
+	Asset(name string) (data []byte, ok bool, err error)
+}
+
+// templateSource finds templates and images under the templates directory
+// first and then in the asset store.
+type templateSource struct {
 	templatesDir string
-	browser      *rod.Browser
+	assets       AssetStore
+}
+
+type HTMLGenerator struct {
+	templateSource
+	options Options
+	pool    *browserPool
 }
 
 type CertificateData struct {
@@ -27,6 +56,9 @@ type CertificateData struct {
 	Event           string
 	Club            string
 	Date            string
+	CertificateCode string
+	VerifyURL       string
+	QRCodeImage     string
 	SideDesignImage string
 	OrgLogo         string
 	ClubLogo        string
@@ -38,168 +70,397 @@ type CertificateData struct {
 	Signer2Title    string
 	Signer3Title    string
 	Signer4Title    string
-}
 
-func NewHTMLGenerator(templatesDir string) (*HTMLGenerator, error) {
-	launcher := launcher.New().
-		Bin("/usr/bin/chromium").
-		Headless(true).
-		Set("no-sandbox").
-		Set("disable-dev-shm-usage")
+	// Meta holds template config values and recipient metadata, for
+	// templates that print fields of their own, such as {{.Meta.team}}.
+	Meta map[string]string
+}
 
-	url, err := launcher.Launch()
+// MetaPrefix marks the data keys that fill CertificateData.Meta: "meta.team"
+// becomes {{.Meta.team}}.
+const MetaPrefix = "meta."
+
+// NewHTMLGenerator starts the headless browsers used for rendering.
+// Templates and images are looked up under templatesDir first and then in
+// assets, which may be nil.
+func NewHTMLGenerator(templatesDir string, assets AssetStore, options Options) (*HTMLGenerator, error) {
+	options = options.withDefaults()
+	source := templateSource{templatesDir: templatesDir, assets: assets}
+	pool, err := newBrowserPool(options, source.hijack)
 	if err != nil {
-		return nil, fmt.Errorf("failed to launch browser: %w", err)
-	}
-
-	browser := rod.New().ControlURL(url)
-	if err := browser.Connect(); err != nil {
-		return nil, fmt.Errorf("failed to connect to browser: %w", err)
+		return nil, err
 	}
 
 	return &HTMLGenerator{
-		templatesDir: templatesDir,
-		browser:      browser,
+		templateSource: source,
+		options:        options,
+		pool:           pool,
 	}, nil
 }
 
 func (g *HTMLGenerator) Close() error {
-	if g.browser != nil {
-		return g.browser.Close()
+	if g.pool != nil {
+		return g.pool.close()
 	}
 	return nil
 }
 
-func (g *HTMLGenerator) Generate(data map[string]string) ([]byte, error) {
-	return g.GenerateWithTemplate("certificate.html", data)
+func (g *HTMLGenerator) Generate(ctx context.Context, data map[string]string) ([]byte, error) {
+	return g.GenerateWithTemplate(ctx, "certificate.html", data)
 }
 
-func (g *HTMLGenerator) GenerateWithTemplate(templateName string, data map[string]string) ([]byte, error) {
-	templatePath := filepath.Join(g.templatesDir, templateName)
-	tmpl, err := template.ParseFiles(templatePath)
+// GenerateWithTemplate renders a template to a PDF, on the paper set up by
+// the page settings in data (see ParsePageSetup). Errors wrapping
+// ErrInvalidTemplate will recur on every attempt; others, such as
+// ErrRenderTimeout or a browser crash, may succeed on retry.
+func (g *HTMLGenerator) GenerateWithTemplate(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	setup, err := pageSetup(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse template: %w", err)
+		return nil, err
+	}
+	htmlContent, err := g.renderHTML(templateName, data)
+	if err != nil {
+		return nil, err
 	}
 
-	certData := g.prepareDataWithImages(data)
+	return g.render(ctx, htmlContent, g.renderTimeout(data), func(page *rod.Page) ([]byte, error) {
+		stream, err := page.PDF(&proto.PagePrintToPDF{
+			PaperWidth:          &setup.Width,
+			PaperHeight:         &setup.Height,
+			MarginTop:           &setup.MarginTop,
+			MarginRight:         &setup.MarginRight,
+			MarginBottom:        &setup.MarginBottom,
+			MarginLeft:          &setup.MarginLeft,
+			Scale:               &setup.Scale,
+			PrintBackground:     true,
+			PreferCSSPageSize:   setup.PreferCSSPageSize,
+			DisplayHeaderFooter: false,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate PDF: %w", err)
+		}
 
-	var htmlBuf bytes.Buffer
-	if err := tmpl.Execute(&htmlBuf, certData); err != nil {
-		return nil, fmt.Errorf("failed to execute template: %w", err)
+		pdfData, err := io.ReadAll(stream)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PDF data: %w", err)
+		}
+		return pdfData, nil
+	})
+}
+
+// GeneratePreview renders a template to a PNG screenshot of its page at 96
+// DPI. Margins and scale only apply to PDFs. Errors are classified as for
+// GenerateWithTemplate.
+func (g *HTMLGenerator) GeneratePreview(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	images, err := g.GenerateImages(ctx, templateName, data, []ImageOptions{{Format: ImagePNG}})
+	if err != nil {
+		return nil, err
 	}
+	return images[0], nil
+}
 
-	htmlContent := htmlBuf.String()
+// GenerateImages renders a template once and screenshots its page for each
+// of options. Errors are classified as for GenerateWithTemplate.
+func (g *HTMLGenerator) GenerateImages(ctx context.Context, templateName string, data map[string]string, options []ImageOptions) ([][]byte, error) {
+	setup, err := pageSetup(data)
+	if err != nil {
+		return nil, err
+	}
+	htmlContent, err := g.renderHTML(templateName, data)
+	if err != nil {
+		return nil, err
+	}
 
-	page := g.browser.MustPage()
-	defer page.MustClose()
+	width, height := setup.pixels()
+	images := make([][]byte, len(options))
+	_, err = g.render(ctx, htmlContent, g.renderTimeout(data), func(page *rod.Page) ([]byte, error) {
+		for i, option := range options {
+			if err := page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
+				Width:             width,
+				Height:            height,
+				DeviceScaleFactor: option.dpi(setup.Width) / previewDPI,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to set viewport: %w", err)
+			}
 
-	page.MustSetDocumentContent(htmlContent)
-	page.MustWaitLoad()
-	page.MustWaitStable()
+			quality := option.quality()
+			request := &proto.PageCaptureScreenshot{Format: proto.PageCaptureScreenshotFormatPng}
+			switch option.Format {
+			case ImageJPEG:
+				request.Format, request.Quality = proto.PageCaptureScreenshotFormatJpeg, &quality
+			case ImageWebP:
+				request.Format, request.Quality = proto.PageCaptureScreenshotFormatWebp, &quality
+			}
 
-	page.MustEval(`() => {
-		return document.fonts.ready;
-	}`)
-
-	page.MustEval(`() => new Promise(resolve => setTimeout(resolve, 300))`)
-
-	paperWidth := 8.27
-	paperHeight := 11.69
-	marginTop := 0.0
-	marginRight := 0.0
-	marginBottom := 0.0
-	marginLeft := 0.0
-
-	stream, err := page.PDF(&proto.PagePrintToPDF{
-		PaperWidth:          &paperWidth,
-		PaperHeight:         &paperHeight,
-		MarginTop:           &marginTop,
-		MarginRight:         &marginRight,
-		MarginBottom:        &marginBottom,
-		MarginLeft:          &marginLeft,
-		PrintBackground:     true,
-		PreferCSSPageSize:   false,
-		DisplayHeaderFooter: false,
+			image, err := page.Screenshot(false, request)
+			if err != nil {
+				return nil, fmt.Errorf("failed to capture %s image: %w", option.Format, err)
+			}
+			images[i] = image
+		}
+		return nil, nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate PDF: %w", err)
+		return nil, err
 	}
+	return images, nil
+}
+
+// render loads HTML into a pooled page and runs capture on it, giving up
+// after timeout. A panic in the browser driver is returned as an error
+// instead of taking down the worker.
+func (g *HTMLGenerator) render(ctx context.Context, htmlContent string, timeout time.Duration, capture func(page *rod.Page) ([]byte, error)) (output []byte, err error) {
+	pooled, err := g.pool.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reuse := false
+	defer func() {
+		if r := recover(); r != nil {
+			output, err = nil, fmt.Errorf("browser failed while rendering: %v", r)
+		}
+		g.pool.release(pooled, reuse)
+	}()
+
+	renderCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	page := pooled.Page.Context(renderCtx)
 
-	pdfData, err := io.ReadAll(stream)
+	if err := loadPage(page, htmlContent); err != nil {
+		return nil, renderError(renderCtx, timeout, err)
+	}
+	output, err = capture(page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read PDF data: %w", err)
+		return nil, renderError(renderCtx, timeout, err)
 	}
 
-	return pdfData, nil
+	reuse = true
+	return output, nil
 }
 
-func (g *HTMLGenerator) prepareDataWithImages(data map[string]string) CertificateData {
-	certData := CertificateData{
-		Name:         getOrDefault(data, "name", ""),
-		StudentID:    getOrDefault(data, "student_id", ""),
-		Course:       getOrDefault(data, "course", ""),
-		Event:        getOrDefault(data, "event", ""),
-		Club:         getOrDefault(data, "club", ""),
-		Date:         getOrDefault(data, "date", ""),
-		Signer1Title: getOrDefault(data, "signer1_title", "Event Coordinator"),
-		Signer2Title: getOrDefault(data, "signer2_title", "Head Of Department\n(CSE)"),
-		Signer3Title: getOrDefault(data, "signer3_title", "Director,\nBhimtal Campus"),
-	}
-
-	sideDesign := getOrDefault(data, "side_design", "side.svg")
-	orgLogo := getOrDefault(data, "org_logo", "gehu-bhimtal-logo.svg")
-	clubLogo := getOrDefault(data, "club_logo", "club.svg")
-	sig1 := getOrDefault(data, "signature1", "cc.png")
-	sig2 := getOrDefault(data, "signature2", "hod_cse.png")
-	sig3 := getOrDefault(data, "signature3", "btl_dir.png")
-
-	certData.SideDesignImage = g.getImageDataURI(sideDesign)
-	certData.OrgLogo = g.getImageDataURI(orgLogo)
-	certData.ClubLogo = g.getImageDataURI(clubLogo)
-	certData.Signature1Image = g.getImageDataURI(sig1)
-	certData.Signature2Image = g.getImageDataURI(sig2)
-	certData.Signature3Image = g.getImageDataURI(sig3)
+func renderError(ctx context.Context, timeout time.Duration, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %v", ErrRenderTimeout, timeout, err)
+	}
+	return err
+}
 
-	return certData
+// renderTimeout reads the render_timeout template setting, in seconds.
+func (g *HTMLGenerator) renderTimeout(data map[string]string) time.Duration {
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(data["render_timeout"]), 64)
+	if err != nil || seconds <= 0 {
+		return g.options.RenderTimeout
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > maxRenderTimeout {
+		return maxRenderTimeout
+	}
+	return timeout
 }
 
-func (g *HTMLGenerator) getImageDataURI(filename string) string {
-	if filename == "" {
-		return ""
+func (g *HTMLGenerator) parseTemplate(templateName string) (*template.Template, error) {
+	content, ok, err := g.lookup(templateName, templateName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template %s: %w", templateName, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: template %s not found", ErrInvalidTemplate, templateName)
 	}
 
-	possiblePaths := []string{
-		filepath.Join(g.templatesDir, "images", filename),
-		filepath.Join(g.templatesDir, filename),
+	// Meta keys a recipient lacks print as nothing rather than "<no value>".
+	tmpl, err := template.New(templateName).Option("missingkey=zero").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
 	}
+	return tmpl, nil
+}
 
-	for _, path := range possiblePaths {
-		if info, err := os.Stat(path); err == nil && !info.IsDir() {
-			dataURI, err := g.fileToDataURI(path)
-			if err == nil && dataURI != "" {
-				return dataURI
+// lookup reads the first of paths, relative to the templates directory,
+// that exists, and otherwise the asset called name. ok is false if neither
+// exists. Paths come from template configs and layouts, so any that would
+// leave the templates directory are ignored.
+func (s templateSource) lookup(name string, paths ...string) ([]byte, bool, error) {
+	for _, path := range paths {
+		if !filepath.IsLocal(path) {
+			continue
+		}
+		fullPath := filepath.Join(s.templatesDir, path)
+		if info, err := os.Stat(fullPath); err == nil && !info.IsDir() {
+			data, err := os.ReadFile(fullPath)
+			if err != nil {
+				return nil, false, err
 			}
+			return data, true, nil
 		}
 	}
 
-	return ""
+	if s.assets != nil {
+		return s.assets.Asset(name)
+	}
+	return nil, false, nil
+}
+
+// image looks an image up under images/, then the templates directory, then
+// the asset store.
+func (s templateSource) image(filename string) ([]byte, bool, error) {
+	return s.lookup(filename, filepath.Join("images", filename), filename)
 }
 
-func (g *HTMLGenerator) fileToDataURI(filePath string) (string, error) {
-	data, err := os.ReadFile(filePath)
+func (g *HTMLGenerator) renderHTML(templateName string, data map[string]string) (string, error) {
+	tmpl, err := g.parseTemplate(templateName)
+	if err != nil {
+		return "", err
+	}
+
+	certData, err := g.prepareDataWithImages(data)
 	if err != nil {
 		return "", err
 	}
 
+	var htmlBuf bytes.Buffer
+	if err := tmpl.Execute(&htmlBuf, certData); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+
+	return htmlBuf.String(), nil
+}
+
+// loadPage sets a page's HTML and waits until its fonts and images have
+// settled.
+func loadPage(page *rod.Page, htmlContent string) error {
+	if err := page.SetDocumentContent(htmlContent); err != nil {
+		return fmt.Errorf("failed to set page content: %w", err)
+	}
+	if err := page.WaitLoad(); err != nil {
+		return fmt.Errorf("failed waiting for page load: %w", err)
+	}
+	if err := page.WaitStable(time.Second); err != nil {
+		return fmt.Errorf("failed waiting for page to settle: %w", err)
+	}
+
+	if _, err := page.Eval(`() => {
+		return document.fonts.ready;
+	}`); err != nil {
+		return fmt.Errorf("failed waiting for fonts: %w", err)
+	}
+
+	if _, err := page.Eval(`() => new Promise(resolve => setTimeout(resolve, 300))`); err != nil {
+		return fmt.Errorf("failed waiting for page to settle: %w", err)
+	}
+	return nil
+}
+
+// DefaultImages are the bundled images an HTML template shows for the image
+// settings its config leaves out or empty.
+var DefaultImages = map[string]string{
+	"side_design": "side.svg",
+	"org_logo":    "gehu-bhimtal-logo.svg",
+	"club_logo":   "club.svg",
+	"signature1":  "cc.png",
+	"signature2":  "hod_cse.png",
+	"signature3":  "btl_dir.png",
+}
+
+func (g *HTMLGenerator) prepareDataWithImages(data map[string]string) (CertificateData, error) {
+	certData := certificateData(data)
+
+	sideDesign := getOrDefault(data, "side_design", DefaultImages["side_design"])
+	orgLogo := getOrDefault(data, "org_logo", DefaultImages["org_logo"])
+	clubLogo := getOrDefault(data, "club_logo", DefaultImages["club_logo"])
+	sig1 := getOrDefault(data, "signature1", DefaultImages["signature1"])
+	sig2 := getOrDefault(data, "signature2", DefaultImages["signature2"])
+	sig3 := getOrDefault(data, "signature3", DefaultImages["signature3"])
+
+	images := []struct {
+		filename string
+		dest     *string
+	}{
+		{sideDesign, &certData.SideDesignImage},
+		{orgLogo, &certData.OrgLogo},
+		{clubLogo, &certData.ClubLogo},
+		{sig1, &certData.Signature1Image},
+		{sig2, &certData.Signature2Image},
+		{sig3, &certData.Signature3Image},
+	}
+	for _, image := range images {
+		dataURI, err := g.getImageDataURI(image.filename)
+		if err != nil {
+			return certData, err
+		}
+		*image.dest = dataURI
+	}
+
+	if certData.VerifyURL != "" {
+		size := parseQRSize(getOrDefault(data, "qr_size", ""))
+		level := parseQRLevel(getOrDefault(data, "qr_error_correction", ""))
+		if qr, err := generateQRCodeDataURI(certData.VerifyURL, size, level); err == nil {
+			certData.QRCodeImage = qr
+		}
+	}
+
+	return certData, nil
+}
+
+// certificateData fills the text fields of CertificateData from the data
+// passed to a generator.
+func certificateData(data map[string]string) CertificateData {
+	certData := CertificateData{
+		Name:            getOrDefault(data, "name", ""),
+		StudentID:       getOrDefault(data, "student_id", ""),
+		Course:          getOrDefault(data, "course", ""),
+		Event:           getOrDefault(data, "event", ""),
+		Club:            getOrDefault(data, "club", ""),
+		Date:            getOrDefault(data, "date", ""),
+		CertificateCode: getOrDefault(data, "code", ""),
+		VerifyURL:       getOrDefault(data, "verify_url", ""),
+		Signer1Title:    getOrDefault(data, "signer1_title", "Event Coordinator"),
+		Signer2Title:    getOrDefault(data, "signer2_title", "Head Of Department\n(CSE)"),
+		Signer3Title:    getOrDefault(data, "signer3_title", "Director,\nBhimtal Campus"),
+		Meta:            make(map[string]string),
+	}
+
+	for key, value := range data {
+		if name, ok := strings.CutPrefix(key, MetaPrefix); ok {
+			certData.Meta[name] = value
+		}
+	}
+
+	return certData
+}
+
+// getImageDataURI returns an image as a data URI, or "" if there is no
+// image by that name.
+func (g *HTMLGenerator) getImageDataURI(filename string) (string, error) {
+	if filename == "" {
+		return "", nil
+	}
+
+	data, ok, err := g.image(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to load image %s: %w", filename, err)
+	}
+	if !ok || len(data) == 0 {
+		return "", nil
+	}
+	return toDataURI(filename, data), nil
+}
+
+func toDataURI(filename string, data []byte) string {
 	mimeType := "image/png"
-	if strings.HasSuffix(strings.ToLower(filePath), ".svg") {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".svg":
 		mimeType = "image/svg+xml"
-	} else if strings.HasSuffix(strings.ToLower(filePath), ".jpg") || strings.HasSuffix(strings.ToLower(filePath), ".jpeg") {
+	case ".jpg", ".jpeg":
 		mimeType = "image/jpeg"
+	case ".webp":
+		mimeType = "image/webp"
+	case ".gif":
+		mimeType = "image/gif"
 	}
 
 	encoded := base64.StdEncoding.EncodeToString(data)
-	return fmt.Sprintf("data:%s;base64,%s", mimeType, encoded), nil
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, encoded)
 }
 
 func getOrDefault(data map[string]string, key, defaultValue string) string {
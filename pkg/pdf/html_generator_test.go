@@ -0,0 +1,60 @@
+package pdf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testAssets map[string]string
+
+func (a testAssets) Asset(name string) ([]byte, bool, error) {
+	data, ok := a[name]
+	return []byte(data), ok, nil
+}
+
+func TestTemplateSourceLookupStaysInTemplatesDir(t *testing.T) {
+	root := t.TempDir()
+	templatesDir := filepath.Join(root, "templates")
+	for path, data := range map[string]string{
+		filepath.Join(root, "config.yaml"):                "secret",
+		filepath.Join(templatesDir, "certificate.html"):   "bundled",
+		filepath.Join(templatesDir, "images", "logo.svg"): "logo",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := templateSource{templatesDir: templatesDir, assets: testAssets{"uploaded.html": "uploaded"}}
+
+	tests := []struct {
+		name   string
+		lookup func(string) ([]byte, bool, error)
+		want   string // "" when not found
+	}{
+		{name: "certificate.html", want: "bundled"},
+		{name: "uploaded.html", want: "uploaded"},
+		{name: "../config.yaml"},
+		{name: "images/../../config.yaml"},
+		{name: filepath.Join(root, "config.yaml")},
+		{name: "logo.svg", lookup: source.image, want: "logo"},
+		{name: "../../config.yaml", lookup: source.image},
+	}
+	for _, tt := range tests {
+		lookup := tt.lookup
+		if lookup == nil {
+			lookup = func(name string) ([]byte, bool, error) { return source.lookup(name, name) }
+		}
+		data, ok, err := lookup(tt.name)
+		if err != nil {
+			t.Errorf("lookup(%q) error = %v", tt.name, err)
+			continue
+		}
+		if got := string(data); ok != (tt.want != "") || got != tt.want {
+			t.Errorf("lookup(%q) = %q, %v; want %q", tt.name, got, ok, tt.want)
+		}
+	}
+}
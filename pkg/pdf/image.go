@@ -0,0 +1,65 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ImageFormat is a raster format certificates can be rendered in.
+type ImageFormat string
+
+const (
+	ImagePNG  ImageFormat = "png"
+	ImageJPEG ImageFormat = "jpeg"
+	ImageWebP ImageFormat = "webp"
+)
+
+const (
+	defaultImageQuality = 90
+	maxImageDPI         = 600
+)
+
+// ParseImageFormat reads an image format name, accepting "jpg" for JPEG.
+func ParseImageFormat(value string) (ImageFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "png":
+		return ImagePNG, nil
+	case "jpeg", "jpg":
+		return ImageJPEG, nil
+	case "webp":
+		return ImageWebP, nil
+	default:
+		return "", fmt.Errorf("unknown image format %q", value)
+	}
+}
+
+// ImageOptions describes one raster image of a certificate page.
+type ImageOptions struct {
+	Format ImageFormat
+	// DPI is the resolution, up to 600; 96 renders the page at its CSS
+	// pixel size, which is also the default.
+	DPI float64
+	// Width, if set, scales the page to this many pixels wide instead.
+	Width int
+	// Quality of JPEG and WebP images, from 1 to 100. Defaults to 90.
+	Quality int
+}
+
+// dpi returns the resolution to render a page pageWidth inches wide at.
+func (o ImageOptions) dpi(pageWidth float64) float64 {
+	dpi := o.DPI
+	if o.Width > 0 {
+		dpi = float64(o.Width) / pageWidth
+	}
+	if dpi <= 0 {
+		return previewDPI
+	}
+	return min(dpi, maxImageDPI)
+}
+
+func (o ImageOptions) quality() int {
+	if o.Quality < 1 || o.Quality > 100 {
+		return defaultImageQuality
+	}
+	return o.Quality
+}
@@ -0,0 +1,431 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultFontSize = 12.0
+	minFontSize     = 6.0
+	lineSpacing     = 1.2
+)
+
+// OverlayRenderer renders certificates without a browser, by drawing text,
+// images and a QR code at fixed positions over a background design. Its
+// templates are JSON layouts (see overlayLayout), looked up like HTML
+// templates.
+type OverlayRenderer struct {
+	templateSource
+}
+
+// NewOverlayRenderer creates an OverlayRenderer. Layouts, images and fonts
+// are looked up under templatesDir first and then in assets, which may be
+// nil.
+func NewOverlayRenderer(templatesDir string, assets AssetStore) *OverlayRenderer {
+	return &OverlayRenderer{templateSource: templateSource{templatesDir: templatesDir, assets: assets}}
+}
+
+func (r *OverlayRenderer) Close() error {
+	return nil
+}
+
+// overlayLayout is an overlay template. Positions and sizes are in
+// millimetres from the top-left corner of the page. Layouts that leave out
+// the page size take it from the template's page settings.
+type overlayLayout struct {
+	Width      float64       `json:"width"`
+	Height     float64       `json:"height"`
+	Background string        `json:"background"`
+	Items      []overlayItem `json:"items"`
+
+	templates *template.Template
+}
+
+// overlayItem is one thing drawn on the page: text, an image, or the QR
+// code for the certificate's verify URL.
+type overlayItem struct {
+	// Type is "text" (the default), "image" or "qr".
+	Type string `json:"type"`
+	// Text is a Go template over CertificateData, as in HTML templates.
+	// Lines are split on newlines.
+	Text string `json:"text"`
+	// Image names an image, looked up like the images of HTML templates.
+	Image string  `json:"image"`
+	X     float64 `json:"x"`
+	// Y is the baseline of the first line of text, or the top of an image.
+	Y float64 `json:"y"`
+	// Width sizes images and QR codes. For text, it is the widest the text
+	// may run; longer text is shrunk to fit.
+	Width float64 `json:"width"`
+	// Height of an image, worked out from its aspect ratio if left out.
+	Height float64 `json:"height"`
+	// Size is the font size in points.
+	Size float64 `json:"size"`
+	// Font is one of the bundled fonts (see overlayFonts) or a .ttf file.
+	Font string `json:"font"`
+	// Color is "#rgb" or "#rrggbb", black by default.
+	Color string `json:"color"`
+	// Align places text left of, centred on or right of X.
+	Align string `json:"align"`
+
+	tmpl *template.Template
+}
+
+func (r *OverlayRenderer) GenerateWithTemplate(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	layout, err := r.loadLayout(templateName)
+	if err != nil {
+		return nil, err
+	}
+	width, height, err := layout.pageSize(data)
+	if err != nil {
+		return nil, err
+	}
+	return r.render(ctx, layout, data, width, height, newPDFCanvas(width, height))
+}
+
+// GeneratePreview renders a layout to a PNG at 96 DPI, the resolution of
+// HTML previews.
+func (r *OverlayRenderer) GeneratePreview(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	images, err := r.GenerateImages(ctx, templateName, data, []ImageOptions{{Format: ImagePNG}})
+	if err != nil {
+		return nil, err
+	}
+	return images[0], nil
+}
+
+// GenerateImages renders a layout to one image per options. There is no
+// pure-Go WebP encoder, so WebP images are left nil.
+func (r *OverlayRenderer) GenerateImages(ctx context.Context, templateName string, data map[string]string, options []ImageOptions) ([][]byte, error) {
+	layout, err := r.loadLayout(templateName)
+	if err != nil {
+		return nil, err
+	}
+	width, height, err := layout.pageSize(data)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([][]byte, len(options))
+	for i, option := range options {
+		if option.Format == ImageWebP {
+			continue
+		}
+		canvas := newImageCanvas(width, height, option.dpi(width/mmPerInch), option.Format, option.quality())
+		images[i], err = r.render(ctx, layout, data, width, height, canvas)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+// TemplateFields returns the CertificateData fields the layout's text
+// prints, as HTMLGenerator.TemplateFields does.
+func (r *OverlayRenderer) TemplateFields(templateName string) ([]string, error) {
+	layout, err := r.loadLayout(templateName)
+	if err != nil {
+		return nil, err
+	}
+
+	return walkTemplate(layout.templates).printedFields(), nil
+}
+
+// ValidateTemplate checks that a layout parses, that its text only uses
+// fields of CertificateData and that its images and fonts exist. images is
+// not used: layouts name their own images.
+func (r *OverlayRenderer) ValidateTemplate(templateName string, images map[string]string) ([]TemplateProblem, error) {
+	content, ok, err := r.lookup(templateName, templateName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up template %s: %w", templateName, err)
+	}
+	if !ok {
+		return []TemplateProblem{{Field: "template_name", Message: fmt.Sprintf("template %s not found", templateName)}}, nil
+	}
+
+	layout, problems := parseLayout(templateName, content)
+	if layout == nil {
+		return problems, nil
+	}
+
+	var imageNames []string
+	if layout.Background != "" {
+		imageNames = append(imageNames, layout.Background)
+	}
+	fontNames := make(map[string]bool)
+	for _, item := range layout.Items {
+		switch item.Type {
+		case "image":
+			if item.Image != "" {
+				imageNames = append(imageNames, item.Image)
+			}
+		case "text":
+			fontNames[item.Font] = true
+		}
+	}
+	for _, name := range imageNames {
+		_, ok, err := r.image(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up image %s: %w", name, err)
+		}
+		if !ok {
+			problems = append(problems, TemplateProblem{Field: "template_name", Message: fmt.Sprintf("image %s not found", name)})
+		}
+	}
+	for name := range fontNames {
+		if _, err := r.font(name); err != nil {
+			problems = append(problems, TemplateProblem{Field: "template_name", Message: err.Error()})
+		}
+	}
+
+	fieldProblems := checkFields(layout.templates)
+	problems = append(problems, fieldProblems...)
+	if len(fieldProblems) == 0 {
+		sample := sampleData()
+		for i, item := range layout.Items {
+			if item.tmpl == nil {
+				continue
+			}
+			if err := item.tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+				problems = append(problems, TemplateProblem{Field: "template_name", Message: fmt.Sprintf("items[%d]: %v", i, err)})
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+func (r *OverlayRenderer) loadLayout(templateName string) (*overlayLayout, error) {
+	content, ok, err := r.lookup(templateName, templateName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template %s: %w", templateName, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: template %s not found", ErrInvalidTemplate, templateName)
+	}
+
+	layout, problems := parseLayout(templateName, content)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTemplate, problems[0].Message)
+	}
+	return layout, nil
+}
+
+// parseLayout decodes a layout, fills in defaults and parses its text. The
+// layout is nil if it cannot be used at all.
+func parseLayout(templateName string, content []byte) (*overlayLayout, []TemplateProblem) {
+	problem := func(format string, args ...any) TemplateProblem {
+		return TemplateProblem{Field: "template_name", Message: fmt.Sprintf(format, args...)}
+	}
+
+	var layout overlayLayout
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&layout); err != nil {
+		return nil, []TemplateProblem{problem("layout is not valid: %v", err)}
+	}
+
+	var problems []TemplateProblem
+	if (layout.Width != 0 || layout.Height != 0) && (layout.Width <= 0 || layout.Height <= 0) {
+		problems = append(problems, problem("width and height must both be positive"))
+	}
+	if layout.Background != "" && !filepath.IsLocal(layout.Background) {
+		problems = append(problems, problem("background must be a file name"))
+	}
+
+	// Missing Meta keys print as nothing, as in HTML templates.
+	layout.templates = template.New(templateName).Option("missingkey=zero")
+	for i := range layout.Items {
+		item := &layout.Items[i]
+		at := fmt.Sprintf("items[%d]", i)
+
+		if item.Type == "" {
+			item.Type = "text"
+		}
+		switch item.Type {
+		case "text":
+			if item.Size == 0 {
+				item.Size = defaultFontSize
+			}
+			if item.Size < 0 || item.Width < 0 {
+				problems = append(problems, problem("%s: size and width cannot be negative", at))
+			}
+			switch item.Align {
+			case "", "left", "center", "right":
+			default:
+				problems = append(problems, problem("%s: align must be left, center or right", at))
+			}
+			if _, err := parseColor(item.Color); err != nil {
+				problems = append(problems, problem("%s: %v", at, err))
+			}
+			if item.Font != "" && overlayFonts[item.Font] == nil {
+				if !strings.EqualFold(filepath.Ext(item.Font), ".ttf") {
+					problems = append(problems, problem("%s: font %q is neither a bundled font nor a .ttf file", at, item.Font))
+				} else if !filepath.IsLocal(item.Font) {
+					problems = append(problems, problem("%s: font must be a file name", at))
+				}
+			}
+			tmpl, err := layout.templates.New(at).Parse(item.Text)
+			if err != nil {
+				problems = append(problems, problem("%s: %v", at, err))
+				continue
+			}
+			item.tmpl = tmpl
+		case "image":
+			if item.Image == "" {
+				problems = append(problems, problem("%s: image is required", at))
+			} else if !filepath.IsLocal(item.Image) {
+				problems = append(problems, problem("%s: image must be a file name", at))
+			}
+			if item.Width <= 0 || item.Height < 0 {
+				problems = append(problems, problem("%s: width must be positive", at))
+			}
+		case "qr":
+			if item.Width <= 0 {
+				problems = append(problems, problem("%s: width must be positive", at))
+			}
+		default:
+			problems = append(problems, problem("%s: unknown type %q", at, item.Type))
+		}
+	}
+
+	return &layout, problems
+}
+
+// pageSize returns the size of a layout's page in millimetres.
+func (l *overlayLayout) pageSize(data map[string]string) (float64, float64, error) {
+	if l.Width > 0 && l.Height > 0 {
+		return l.Width, l.Height, nil
+	}
+	setup, err := pageSetup(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	return setup.Width * mmPerInch, setup.Height * mmPerInch, nil
+}
+
+// render draws a layout onto a canvas of the given size. A panic while
+// decoding a design is returned as an error, as for browser renders.
+func (r *OverlayRenderer) render(ctx context.Context, layout *overlayLayout, data map[string]string, width, height float64, canvas overlayCanvas) (output []byte, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			output, err = nil, fmt.Errorf("%w: failed while rendering: %v", ErrInvalidTemplate, rec)
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	certData := certificateData(data)
+
+	if layout.Background != "" {
+		if err := r.drawImage(canvas, layout.Background, 0, 0, width, height); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, item := range layout.Items {
+		switch item.Type {
+		case "image":
+			if err := r.drawImage(canvas, item.Image, item.X, item.Y, item.Width, item.Height); err != nil {
+				return nil, err
+			}
+		case "qr":
+			if certData.VerifyURL == "" {
+				continue
+			}
+			size := parseQRSize(getOrDefault(data, "qr_size", ""))
+			level := parseQRLevel(getOrDefault(data, "qr_error_correction", ""))
+			png, err := qrcode.Encode(certData.VerifyURL, level, size)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode QR code: %w", err)
+			}
+			if err := canvas.drawImage("qr.png", png, item.X, item.Y, item.Width, item.Width); err != nil {
+				return nil, err
+			}
+		case "text":
+			var text bytes.Buffer
+			if err := item.tmpl.Execute(&text, certData); err != nil {
+				return nil, fmt.Errorf("%w: items[%d]: %v", ErrInvalidTemplate, i, err)
+			}
+			if err := r.drawText(canvas, item, text.String()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return canvas.output()
+}
+
+// drawImage draws an image into a box. A height of zero keeps the image's
+// aspect ratio.
+func (r *OverlayRenderer) drawImage(canvas overlayCanvas, name string, x, y, width, height float64) error {
+	data, ok, err := r.image(name)
+	if err != nil {
+		return fmt.Errorf("failed to load image %s: %w", name, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: image %s not found", ErrInvalidTemplate, name)
+	}
+
+	if height == 0 {
+		w, h, err := imageSize(name, data)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+		height = width * h / w
+	}
+	return canvas.drawImage(name, data, x, y, width, height)
+}
+
+func (r *OverlayRenderer) drawText(canvas overlayCanvas, item overlayItem, text string) error {
+	text = strings.TrimRight(text, "\n")
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	font, err := r.font(item.Font)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	textColor, _ := parseColor(item.Color)
+
+	lines := strings.Split(text, "\n")
+	size := item.Size
+	if item.Width > 0 {
+		widest := 0.0
+		for _, line := range lines {
+			widest = max(widest, font.width(line, size))
+		}
+		if widest > item.Width {
+			size = max(minFontSize, size*item.Width/widest)
+		}
+	}
+
+	y := item.Y
+	for _, line := range lines {
+		x := item.X
+		switch item.Align {
+		case "center":
+			x -= font.width(line, size) / 2
+		case "right":
+			x -= font.width(line, size)
+		}
+		if err := canvas.drawText(line, font, size, textColor, x, y); err != nil {
+			return err
+		}
+		y += size * lineSpacing * mmPerPoint
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	mmPerInch  = 25.4
+	mmPerPoint = mmPerInch / 72
+
+	previewDPI = 96.0
+	// rasterDPI is the resolution SVG and other non-PNG/JPEG designs are
+	// embedded into PDFs at, enough for print.
+	rasterDPI = 200.0
+)
+
+// overlayFonts are the fonts layouts can use without uploading one. The Go
+// fonts are embedded, so PDFs and previews measure text identically.
+var overlayFonts = map[string][]byte{
+	"sans":             goregular.TTF,
+	"sans-bold":        gobold.TTF,
+	"sans-italic":      goitalic.TTF,
+	"sans-bold-italic": gobolditalic.TTF,
+	"mono":             gomono.TTF,
+	"mono-bold":        gomonobold.TTF,
+}
+
+var (
+	bundledFontsOnce sync.Once
+	bundledFonts     map[string]*overlayFont
+	bundledFontsErr  error
+)
+
+type overlayFont struct {
+	name string
+	data []byte
+	font *opentype.Font
+}
+
+// width measures a line of text in millimetres.
+func (f *overlayFont) width(text string, size float64) float64 {
+	face, err := opentype.NewFace(f.font, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return 0
+	}
+	defer face.Close()
+	return float64(font.MeasureString(face, text)) / 64 * mmPerPoint
+}
+
+// font returns a bundled font, or a .ttf file looked up under fonts/, then
+// the templates directory, then the asset store. The default is sans.
+func (r *OverlayRenderer) font(name string) (*overlayFont, error) {
+	if name == "" {
+		name = "sans"
+	}
+
+	if _, ok := overlayFonts[name]; ok {
+		bundledFontsOnce.Do(func() {
+			bundledFonts = make(map[string]*overlayFont, len(overlayFonts))
+			for fontName, data := range overlayFonts {
+				parsed, err := opentype.Parse(data)
+				if err != nil {
+					bundledFontsErr = fmt.Errorf("failed to parse font %s: %w", fontName, err)
+					return
+				}
+				bundledFonts[fontName] = &overlayFont{name: fontName, data: data, font: parsed}
+			}
+		})
+		if bundledFontsErr != nil {
+			return nil, bundledFontsErr
+		}
+		return bundledFonts[name], nil
+	}
+
+	data, ok, err := r.lookup(name, filepath.Join("fonts", name), name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load font %s: %w", name, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("font %s not found", name)
+	}
+	parsed, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("font %s is not a valid TrueType font: %v", name, err)
+	}
+	return &overlayFont{name: name, data: data, font: parsed}, nil
+}
+
+// parseColor reads "#rgb" or "#rrggbb". The empty string is black.
+func parseColor(value string) (color.RGBA, error) {
+	black := color.RGBA{A: 255}
+	if value == "" {
+		return black, nil
+	}
+
+	hex, ok := strings.CutPrefix(value, "#")
+	if ok && len(hex) == 3 {
+		hex = strings.Repeat(hex[0:1], 2) + strings.Repeat(hex[1:2], 2) + strings.Repeat(hex[2:3], 2)
+	}
+	if !ok || len(hex) != 6 {
+		return black, fmt.Errorf("color %q must be #rgb or #rrggbb", value)
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return black, fmt.Errorf("color %q must be #rgb or #rrggbb", value)
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}, nil
+}
+
+func isSVG(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".svg")
+}
+
+// imageSize returns an image's width and height in any unit, for its aspect
+// ratio.
+func imageSize(name string, data []byte) (float64, float64, error) {
+	if isSVG(name) {
+		icon, err := oksvg.ReadIconStream(bytes.NewReader(data), oksvg.IgnoreErrorMode)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read image %s: %v", name, err)
+		}
+		if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+			return 0, 0, fmt.Errorf("image %s has no size; set a height for it", name)
+		}
+		return icon.ViewBox.W, icon.ViewBox.H, nil
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read image %s: %v", name, err)
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return 0, 0, fmt.Errorf("image %s is empty", name)
+	}
+	return float64(config.Width), float64(config.Height), nil
+}
+
+// decodeImage decodes a raster image, or rasterizes an SVG at the given
+// pixel size.
+func decodeImage(name string, data []byte, width, height int) (image.Image, error) {
+	if !isSVG(name) {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode image %s: %v", ErrInvalidTemplate, name, err)
+		}
+		return img, nil
+	}
+
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read image %s: %v", ErrInvalidTemplate, name, err)
+	}
+	width, height = max(width, 1), max(height, 1)
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+	return img, nil
+}
+
+func pixels(mm, dpi float64) int {
+	return int(math.Round(mm / mmPerInch * dpi))
+}
+
+// overlayCanvas is what a layout is drawn on: a PDF page or an image.
+// Coordinates are in millimetres, and text is drawn from its baseline.
+type overlayCanvas interface {
+	drawImage(name string, data []byte, x, y, width, height float64) error
+	drawText(text string, font *overlayFont, size float64, textColor color.RGBA, x, y float64) error
+	output() ([]byte, error)
+}
+
+type pdfCanvas struct {
+	doc    *fpdf.Fpdf
+	fonts  map[string]bool
+	images int
+}
+
+func newPDFCanvas(width, height float64) *pdfCanvas {
+	doc := fpdf.NewCustom(&fpdf.InitType{
+		UnitStr: "mm",
+		Size:    fpdf.SizeType{Wd: width, Ht: height},
+	})
+	doc.SetMargins(0, 0, 0)
+	doc.SetAutoPageBreak(false, 0)
+	doc.AddPage()
+	return &pdfCanvas{doc: doc, fonts: make(map[string]bool)}
+}
+
+func (c *pdfCanvas) drawImage(name string, data []byte, x, y, width, height float64) error {
+	// fpdf embeds JPEGs as they are but not every PNG, so everything else
+	// is re-encoded as an 8-bit PNG.
+	imageType := "JPG"
+	if http.DetectContentType(data) != "image/jpeg" {
+		img, err := decodeImage(name, data, pixels(width, rasterDPI), pixels(height, rasterDPI))
+		if err != nil {
+			return err
+		}
+		nrgba := image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, nrgba.Bounds(), img, img.Bounds().Min, draw.Src)
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, nrgba); err != nil {
+			return fmt.Errorf("failed to encode image %s: %w", name, err)
+		}
+		data, imageType = buf.Bytes(), "PNG"
+	}
+
+	c.images++
+	options := fpdf.ImageOptions{ImageType: imageType}
+	registered := fmt.Sprintf("image%d", c.images)
+	c.doc.RegisterImageOptionsReader(registered, options, bytes.NewReader(data))
+	c.doc.ImageOptions(registered, x, y, width, height, false, options, 0, "")
+	if err := c.doc.Error(); err != nil {
+		return fmt.Errorf("%w: failed to draw image %s: %v", ErrInvalidTemplate, name, err)
+	}
+	return nil
+}
+
+func (c *pdfCanvas) drawText(text string, font *overlayFont, size float64, textColor color.RGBA, x, y float64) error {
+	if !c.fonts[font.name] {
+		c.doc.AddUTF8FontFromBytes(font.name, "", font.data)
+		c.fonts[font.name] = true
+	}
+	c.doc.SetFont(font.name, "", size)
+	c.doc.SetTextColor(int(textColor.R), int(textColor.G), int(textColor.B))
+	c.doc.Text(x, y, text)
+	if err := c.doc.Error(); err != nil {
+		return fmt.Errorf("%w: failed to draw text with font %s: %v", ErrInvalidTemplate, font.name, err)
+	}
+	return nil
+}
+
+func (c *pdfCanvas) output() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.doc.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to generate PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+type imageCanvas struct {
+	img     *image.RGBA
+	dpi     float64
+	format  ImageFormat
+	quality int
+}
+
+// newImageCanvas creates a white canvas that is output as a PNG, or a JPEG
+// of the given quality.
+func newImageCanvas(width, height, dpi float64, format ImageFormat, quality int) *imageCanvas {
+	img := image.NewRGBA(image.Rect(0, 0, max(pixels(width, dpi), 1), max(pixels(height, dpi), 1)))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	return &imageCanvas{img: img, dpi: dpi, format: format, quality: quality}
+}
+
+func (c *imageCanvas) drawImage(name string, data []byte, x, y, width, height float64) error {
+	rect := image.Rect(pixels(x, c.dpi), pixels(y, c.dpi), pixels(x+width, c.dpi), pixels(y+height, c.dpi))
+	img, err := decodeImage(name, data, rect.Dx(), rect.Dy())
+	if err != nil {
+		return err
+	}
+	xdraw.CatmullRom.Scale(c.img, rect, img, img.Bounds(), xdraw.Over, nil)
+	return nil
+}
+
+func (c *imageCanvas) drawText(text string, f *overlayFont, size float64, textColor color.RGBA, x, y float64) error {
+	face, err := opentype.NewFace(f.font, &opentype.FaceOptions{Size: size, DPI: c.dpi, Hinting: font.HintingNone})
+	if err != nil {
+		return fmt.Errorf("%w: failed to load font %s: %v", ErrInvalidTemplate, f.name, err)
+	}
+	defer face.Close()
+
+	drawer := font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot:  fixed.Point26_6{X: fixed.Int26_6(x / mmPerInch * c.dpi * 64), Y: fixed.Int26_6(y / mmPerInch * c.dpi * 64)},
+	}
+	drawer.DrawString(text)
+	return nil
+}
+
+func (c *imageCanvas) output() ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if c.format == ImageJPEG {
+		err = jpeg.Encode(&buf, c.img, &jpeg.Options{Quality: c.quality})
+	} else {
+		err = png.Encode(&buf, c.img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
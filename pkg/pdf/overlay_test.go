@@ -0,0 +1,273 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testLayout = `{
+	"width": 100,
+	"height": 50,
+	"background": "background.png",
+	"items": [
+		{"text": "{{.Name}}", "x": 50, "y": 25, "size": 14, "align": "center", "width": 80},
+		{"type": "image", "image": "logo.svg", "x": 5, "y": 5, "width": 10},
+		{"type": "qr", "x": 80, "y": 30, "width": 15}
+	]
+}`
+
+// newTestOverlayRenderer writes layouts, a blue background and a red
+// square logo to a templates directory.
+func newTestOverlayRenderer(t *testing.T, layouts map[string]string) *OverlayRenderer {
+	t.Helper()
+	dir := t.TempDir()
+
+	background := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	for x := 0; x < 20; x++ {
+		for y := 0; y < 10; y++ {
+			background.Set(x, y, color.RGBA{B: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, background); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"images/background.png": buf.String(),
+		"images/logo.svg":       `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="10" height="10" fill="#ff0000"/></svg>`,
+	}
+	for name, layout := range layouts {
+		files[name] = layout
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewOverlayRenderer(dir, nil)
+}
+
+func TestOverlayRendererOutput(t *testing.T) {
+	r := newTestOverlayRenderer(t, map[string]string{"layout.json": testLayout})
+	ctx := context.Background()
+	data := map[string]string{"name": "Ada Lovelace", "verify_url": "https://example.com/verify/ABC"}
+
+	pdfData, err := r.GenerateWithTemplate(ctx, "layout.json", data)
+	if err != nil {
+		t.Fatalf("GenerateWithTemplate: %v", err)
+	}
+	if !bytes.HasPrefix(pdfData, []byte("%PDF-")) {
+		t.Errorf("GenerateWithTemplate output starts %q, want a PDF", pdfData[:min(len(pdfData), 8)])
+	}
+
+	tests := []struct {
+		name          string
+		options       ImageOptions
+		decode        func(io.Reader) (image.Image, error)
+		width, height int
+	}{
+		{
+			name:    "png at the default resolution",
+			options: ImageOptions{Format: ImagePNG},
+			decode:  png.Decode,
+			width:   pixels(100, previewDPI), height: pixels(50, previewDPI),
+		},
+		{
+			name:    "png at 300 dpi",
+			options: ImageOptions{Format: ImagePNG, DPI: 300},
+			decode:  png.Decode,
+			width:   pixels(100, 300), height: pixels(50, 300),
+		},
+		{
+			name:    "jpeg scaled to a width",
+			options: ImageOptions{Format: ImageJPEG, Width: 200, Quality: 80},
+			decode:  jpeg.Decode,
+			width:   200, height: 100,
+		},
+		{
+			name:    "webp is not supported",
+			options: ImageOptions{Format: ImageWebP},
+		},
+	}
+
+	var options []ImageOptions
+	for _, tt := range tests {
+		options = append(options, tt.options)
+	}
+	images, err := r.GenerateImages(ctx, "layout.json", data, options)
+	if err != nil {
+		t.Fatalf("GenerateImages: %v", err)
+	}
+	if len(images) != len(tests) {
+		t.Fatalf("GenerateImages returned %d images, want %d", len(images), len(tests))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.decode == nil {
+				if images[i] != nil {
+					t.Errorf("got %d bytes, want none", len(images[i]))
+				}
+				return
+			}
+			img, err := tt.decode(bytes.NewReader(images[i]))
+			if err != nil {
+				t.Fatalf("failed to decode image: %v", err)
+			}
+			if bounds := img.Bounds(); bounds.Dx() != tt.width || bounds.Dy() != tt.height {
+				t.Errorf("image is %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), tt.width, tt.height)
+			}
+
+			// The background fills the page and the logo sits over it, 5mm
+			// in and 10mm wide.
+			dpi := float64(tt.width) / 100 * mmPerInch
+			if c := rgba(img.At(1, 1)); c.B < 200 || c.R > 50 {
+				t.Errorf("background pixel = %v, want blue", c)
+			}
+			if c := rgba(img.At(pixels(10, dpi), pixels(10, dpi))); c.R < 200 || c.B > 50 {
+				t.Errorf("logo pixel = %v, want red", c)
+			}
+		})
+	}
+
+	preview, err := r.GeneratePreview(ctx, "layout.json", data)
+	if err != nil {
+		t.Fatalf("GeneratePreview: %v", err)
+	}
+	if !bytes.Equal(preview, images[0]) {
+		t.Error("GeneratePreview differs from a PNG at the default resolution")
+	}
+
+	fields, err := r.TemplateFields("layout.json")
+	if err != nil || strings.Join(fields, ",") != "Name" {
+		t.Errorf("TemplateFields = %v, %v; want [Name]", fields, err)
+	}
+
+	if _, err := r.GenerateWithTemplate(ctx, "missing.json", data); !errors.Is(err, ErrInvalidTemplate) {
+		t.Errorf("GenerateWithTemplate of a missing layout error = %v, want ErrInvalidTemplate", err)
+	}
+}
+
+func rgba(c color.Color) color.RGBA {
+	r, g, b, a := c.RGBA()
+	return color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)}
+}
+
+func TestOverlayRendererValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+		// problems are substrings of the "field: message" of each problem
+		// expected, in order.
+		problems []string
+	}{
+		{
+			name:   "valid",
+			layout: testLayout,
+		},
+		{
+			name:     "not JSON",
+			layout:   `{"items": [`,
+			problems: []string{"layout is not valid"},
+		},
+		{
+			name:     "unknown setting",
+			layout:   `{"itmes": []}`,
+			problems: []string{`unknown field "itmes"`},
+		},
+		{
+			name:     "half a page size",
+			layout:   `{"width": 100, "items": []}`,
+			problems: []string{"width and height must both be positive"},
+		},
+		{
+			name: "bad text settings",
+			layout: `{"items": [
+				{"text": "{{.Name}}", "size": -1, "align": "justify", "color": "red", "font": "comic.otf"}
+			]}`,
+			problems: []string{
+				"items[0]: size and width cannot be negative",
+				"items[0]: align must be left, center or right",
+				"items[0]: color",
+				`items[0]: font "comic.otf" is neither a bundled font nor a .ttf file`,
+				"font comic.otf not found",
+			},
+		},
+		{
+			name:     "text that does not parse",
+			layout:   `{"items": [{"text": "{{.Name"}]}`,
+			problems: []string{"items[0]:"},
+		},
+		{
+			name:     "unknown field",
+			layout:   `{"items": [{"text": "{{.Nmae}}"}]}`,
+			problems: []string{"Nmae: is not a field the generator provides"},
+		},
+		{
+			name: "bad images and QR codes",
+			layout: `{"items": [
+				{"type": "image", "width": 10},
+				{"type": "image", "image": "logo.svg"},
+				{"type": "qr"},
+				{"type": "barcode"}
+			]}`,
+			problems: []string{
+				"items[0]: image is required",
+				"items[1]: width must be positive",
+				"items[2]: width must be positive",
+				`items[3]: unknown type "barcode"`,
+			},
+		},
+		{
+			name: "missing files",
+			layout: `{"background": "missing.png", "items": [
+				{"type": "image", "image": "missing.svg", "width": 10},
+				{"text": "x", "font": "missing.ttf"}
+			]}`,
+			problems: []string{
+				"image missing.png not found",
+				"image missing.svg not found",
+				"font missing.ttf not found",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestOverlayRenderer(t, map[string]string{"layout.json": tt.layout})
+			problems, err := r.ValidateTemplate("layout.json", nil)
+			if err != nil {
+				t.Fatalf("ValidateTemplate: %v", err)
+			}
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("problems = %v, want %q", problems, tt.problems)
+			}
+			for i, problem := range problems {
+				if got := problem.Field + ": " + problem.Message; !strings.Contains(got, tt.problems[i]) {
+					t.Errorf("problem %d = %q, want it to contain %q", i, got, tt.problems[i])
+				}
+			}
+		})
+	}
+
+	r := newTestOverlayRenderer(t, nil)
+	problems, err := r.ValidateTemplate("missing.json", nil)
+	if err != nil || len(problems) != 1 || !strings.Contains(problems[0].Message, "not found") {
+		t.Errorf("ValidateTemplate of a missing layout = %v, %v", problems, err)
+	}
+}
@@ -0,0 +1,190 @@
+package pdf
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PageSettings are the template data keys ParsePageSetup reads.
+var PageSettings = []string{
+	"page_size",
+	"orientation",
+	"margin",
+	"margin_top",
+	"margin_right",
+	"margin_bottom",
+	"margin_left",
+	"scale",
+	"prefer_css_page_size",
+}
+
+// pageSizes are the named paper sizes, portrait, in millimetres.
+var pageSizes = map[string][2]float64{
+	"a3":      {297, 420},
+	"a4":      {210, 297},
+	"a5":      {148, 210},
+	"letter":  {215.9, 279.4},
+	"legal":   {215.9, 355.6},
+	"tabloid": {279.4, 431.8},
+}
+
+const (
+	minPageScale = 0.1
+	maxPageScale = 2
+	maxPageSize  = 100 // inches
+)
+
+var customPageSize = regexp.MustCompile(`^([0-9.]+)\s*[x×]\s*([0-9.]+)\s*(mm|cm|in)?$`)
+
+// PageSetup is the paper a template prints on. Lengths are in inches, as
+// Chromium takes them.
+type PageSetup struct {
+	Width        float64
+	Height       float64
+	MarginTop    float64
+	MarginRight  float64
+	MarginBottom float64
+	MarginLeft   float64
+	Scale        float64
+	// PreferCSSPageSize lets a template's CSS @page rule override the size.
+	PreferCSSPageSize bool
+}
+
+// ParsePageSetup reads the page settings of a template from its data:
+//
+//   - page_size: A3, A4 (the default), A5, Letter, Legal, Tabloid, or a
+//     custom size such as "297x210mm" or "11x8.5in"
+//   - orientation: portrait or landscape; left out, named sizes are
+//     portrait and custom sizes are as given
+//   - margin, and margin_top etc. to override one side: a length such as
+//     "10mm", "1cm" or "0.5in", in millimetres if it has no unit
+//   - scale: 0.1 to 2
+//   - prefer_css_page_size: true to size the page from CSS @page
+//
+// Problems are keyed by the setting at fault. Data with problems should not
+// be rendered.
+func ParsePageSetup(data map[string]string) (PageSetup, []TemplateProblem) {
+	a4 := pageSizes["a4"]
+	setup := PageSetup{Width: a4[0] / mmPerInch, Height: a4[1] / mmPerInch, Scale: 1}
+	var problems []TemplateProblem
+	problem := func(field, message string) {
+		problems = append(problems, TemplateProblem{Field: field, Message: message})
+	}
+
+	if value := strings.ToLower(strings.TrimSpace(data["page_size"])); value != "" {
+		if size, ok := pageSizes[value]; ok {
+			setup.Width, setup.Height = size[0]/mmPerInch, size[1]/mmPerInch
+		} else if match := customPageSize.FindStringSubmatch(value); match != nil {
+			width, errWidth := parseLength(match[1] + match[3])
+			height, errHeight := parseLength(match[2] + match[3])
+			if errWidth != nil || errHeight != nil || width <= 0 || height <= 0 || width > maxPageSize || height > maxPageSize {
+				problem("page_size", fmt.Sprintf("custom sizes must be positive and at most %d inches a side", maxPageSize))
+			} else {
+				setup.Width, setup.Height = width, height
+			}
+		} else {
+			problem("page_size", "must be A3, A4, A5, Letter, Legal, Tabloid or a size such as 297x210mm")
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(data["orientation"])) {
+	case "":
+	case "portrait":
+		if setup.Width > setup.Height {
+			setup.Width, setup.Height = setup.Height, setup.Width
+		}
+	case "landscape":
+		if setup.Width < setup.Height {
+			setup.Width, setup.Height = setup.Height, setup.Width
+		}
+	default:
+		problem("orientation", "must be portrait or landscape")
+	}
+
+	margins := []struct {
+		key  string
+		dest *float64
+	}{
+		{"margin", nil},
+		{"margin_top", &setup.MarginTop},
+		{"margin_right", &setup.MarginRight},
+		{"margin_bottom", &setup.MarginBottom},
+		{"margin_left", &setup.MarginLeft},
+	}
+	for _, margin := range margins {
+		value := strings.TrimSpace(data[margin.key])
+		if value == "" {
+			continue
+		}
+		length, err := parseLength(value)
+		if err != nil || length < 0 {
+			problem(margin.key, "must be a length such as 10mm, 1cm or 0.5in")
+			continue
+		}
+		if margin.dest == nil {
+			setup.MarginTop, setup.MarginRight, setup.MarginBottom, setup.MarginLeft = length, length, length, length
+		} else {
+			*margin.dest = length
+		}
+	}
+	if setup.MarginLeft+setup.MarginRight >= setup.Width || setup.MarginTop+setup.MarginBottom >= setup.Height {
+		problem("margin", "margins leave no room on the page")
+	}
+
+	if value := strings.TrimSpace(data["scale"]); value != "" {
+		scale, err := strconv.ParseFloat(value, 64)
+		if err != nil || scale < minPageScale || scale > maxPageScale {
+			problem("scale", fmt.Sprintf("must be a number from %g to %g", minPageScale, float64(maxPageScale)))
+		} else {
+			setup.Scale = scale
+		}
+	}
+
+	if value := strings.TrimSpace(data["prefer_css_page_size"]); value != "" {
+		prefer, err := strconv.ParseBool(value)
+		if err != nil {
+			problem("prefer_css_page_size", "must be true or false")
+		} else {
+			setup.PreferCSSPageSize = prefer
+		}
+	}
+
+	return setup, problems
+}
+
+// pageSetup is ParsePageSetup for rendering, where a bad setting fails the
+// render.
+func pageSetup(data map[string]string) (PageSetup, error) {
+	setup, problems := ParsePageSetup(data)
+	if len(problems) > 0 {
+		return setup, fmt.Errorf("%w: %s %s", ErrInvalidTemplate, problems[0].Field, problems[0].Message)
+	}
+	return setup, nil
+}
+
+// pixels returns the page size in CSS pixels, at 96 per inch.
+func (p PageSetup) pixels() (int, int) {
+	return int(math.Round(p.Width * previewDPI)), int(math.Round(p.Height * previewDPI))
+}
+
+// parseLength reads a length in mm, cm or in, in millimetres if it has no
+// unit, and returns it in inches.
+func parseLength(value string) (float64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	perInch := mmPerInch
+	for unit, n := range map[string]float64{"mm": mmPerInch, "cm": mmPerInch / 10, "in": 1} {
+		if number, ok := strings.CutSuffix(value, unit); ok {
+			value, perInch = strings.TrimSpace(number), n
+			break
+		}
+	}
+
+	length, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(length) || math.IsInf(length, 0) {
+		return 0, fmt.Errorf("invalid length %q", value)
+	}
+	return length / perInch, nil
+}
@@ -0,0 +1,133 @@
+package pdf
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParsePageSetup(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]string
+		want PageSetup
+		// problems are the fields with problems, in order.
+		problems []string
+	}{
+		{
+			name: "defaults to A4 portrait",
+			data: map[string]string{},
+			want: PageSetup{Width: 210 / mmPerInch, Height: 297 / mmPerInch, Scale: 1},
+		},
+		{
+			name: "named size landscape",
+			data: map[string]string{"page_size": " Letter ", "orientation": "LANDSCAPE"},
+			want: PageSetup{Width: 11, Height: 8.5, Scale: 1},
+		},
+		{
+			name: "custom size keeps its orientation",
+			data: map[string]string{"page_size": "297x210mm"},
+			want: PageSetup{Width: 297 / mmPerInch, Height: 210 / mmPerInch, Scale: 1},
+		},
+		{
+			name: "custom size turned portrait",
+			data: map[string]string{"page_size": "11 × 8.5in", "orientation": "portrait"},
+			want: PageSetup{Width: 8.5, Height: 11, Scale: 1},
+		},
+		{
+			name: "margins, scale and CSS page size",
+			data: map[string]string{"margin": "1cm", "margin_left": "0.5in", "scale": "0.8", "prefer_css_page_size": "true"},
+			want: PageSetup{
+				Width: 210 / mmPerInch, Height: 297 / mmPerInch,
+				MarginTop: 10 / mmPerInch, MarginRight: 10 / mmPerInch, MarginBottom: 10 / mmPerInch, MarginLeft: 0.5,
+				Scale: 0.8, PreferCSSPageSize: true,
+			},
+		},
+		{
+			name: "margin without a unit is in millimetres",
+			data: map[string]string{"margin_top": "25.4"},
+			want: PageSetup{Width: 210 / mmPerInch, Height: 297 / mmPerInch, MarginTop: 1, Scale: 1},
+		},
+		{
+			name:     "unknown size",
+			data:     map[string]string{"page_size": "b5"},
+			problems: []string{"page_size"},
+		},
+		{
+			name:     "custom size too large",
+			data:     map[string]string{"page_size": "101x10in"},
+			problems: []string{"page_size"},
+		},
+		{
+			name:     "custom size of zero",
+			data:     map[string]string{"page_size": "0x210mm"},
+			problems: []string{"page_size"},
+		},
+		{
+			name:     "bad orientation",
+			data:     map[string]string{"orientation": "sideways"},
+			problems: []string{"orientation"},
+		},
+		{
+			name:     "bad and negative margins",
+			data:     map[string]string{"margin": "wide", "margin_top": "-1mm"},
+			problems: []string{"margin", "margin_top"},
+		},
+		{
+			name:     "margins leave no room",
+			data:     map[string]string{"margin_left": "120mm", "margin_right": "100mm"},
+			problems: []string{"margin"},
+		},
+		{
+			name:     "scale out of range",
+			data:     map[string]string{"scale": "3"},
+			problems: []string{"scale"},
+		},
+		{
+			name:     "scale is not a number",
+			data:     map[string]string{"scale": "NaN%"},
+			problems: []string{"scale"},
+		},
+		{
+			name:     "prefer_css_page_size is not a bool",
+			data:     map[string]string{"prefer_css_page_size": "sometimes"},
+			problems: []string{"prefer_css_page_size"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, problems := ParsePageSetup(tt.data)
+
+			var fields []string
+			for _, problem := range problems {
+				fields = append(fields, problem.Field)
+			}
+			if len(fields) != len(tt.problems) {
+				t.Fatalf("problems = %v, want fields %v", problems, tt.problems)
+			}
+			for i := range fields {
+				if fields[i] != tt.problems[i] {
+					t.Errorf("problem %d is for %q, want %q", i, fields[i], tt.problems[i])
+				}
+			}
+			if len(tt.problems) > 0 {
+				if _, err := pageSetup(tt.data); err == nil {
+					t.Error("pageSetup succeeded for data with problems")
+				}
+				return
+			}
+
+			if !samePageSetup(got, tt.want) {
+				t.Errorf("ParsePageSetup = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func samePageSetup(a, b PageSetup) bool {
+	near := func(x, y float64) bool { return math.Abs(x-y) < 1e-9 }
+	return near(a.Width, b.Width) && near(a.Height, b.Height) &&
+		near(a.MarginTop, b.MarginTop) && near(a.MarginRight, b.MarginRight) &&
+		near(a.MarginBottom, b.MarginBottom) && near(a.MarginLeft, b.MarginLeft) &&
+		near(a.Scale, b.Scale) && a.PreferCSSPageSize == b.PreferCSSPageSize
+}
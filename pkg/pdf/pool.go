@@ -0,0 +1,292 @@
+package pdf
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+const (
+	healthCheckTimeout = 5 * time.Second
+	pageCloseTimeout   = 5 * time.Second
+)
+
+// Options configures the browsers an HTMLGenerator renders with.
+type Options struct {
+	// BrowserPath is the Chromium binary to launch.
+	BrowserPath string
+	// Browsers is how many Chromium processes to keep running. Renders are
+	// spread across them, so a crash only fails the renders in flight on
+	// that browser.
+	Browsers int
+	// MaxConcurrent caps renders in flight across all browsers, however
+	// many queue workers call the generator.
+	MaxConcurrent int
+	// HealthInterval is how often browsers are checked and relaunched if
+	// they have stopped responding.
+	HealthInterval time.Duration
+	// RenderTimeout limits a single render, unless the template sets
+	// render_timeout.
+	RenderTimeout time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.BrowserPath == "" {
+		o.BrowserPath = "/usr/bin/chromium"
+	}
+	if o.Browsers <= 0 {
+		o.Browsers = 1
+	}
+	if o.MaxConcurrent <= 0 {
+		o.MaxConcurrent = 2 * o.Browsers
+	}
+	if o.HealthInterval <= 0 {
+		o.HealthInterval = 30 * time.Second
+	}
+	if o.RenderTimeout <= 0 {
+		o.RenderTimeout = 30 * time.Second
+	}
+	return o
+}
+
+// browserPool hands out pages on a set of browsers, at most MaxConcurrent
+// at a time. Pages are reused between renders while their browser stays
+// up.
+type browserPool struct {
+	slots    chan struct{}
+	browsers []*pooledBrowser
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type pooledBrowser struct {
+	path    string
+	maxIdle int
+	// hijack answers every request the browser's pages make.
+	hijack func(*rod.Hijack)
+
+	mu       sync.Mutex
+	launcher *launcher.Launcher
+	browser  *rod.Browser
+	// generation counts launches, so pages from a browser that has since
+	// been relaunched are not put back.
+	generation int
+	idle       []*rod.Page
+	active     int
+}
+
+// pooledPage is a page checked out of the pool.
+type pooledPage struct {
+	*rod.Page
+	owner      *pooledBrowser
+	generation int
+}
+
+func newBrowserPool(options Options, hijack func(*rod.Hijack)) (*browserPool, error) {
+	pool := &browserPool{
+		slots: make(chan struct{}, options.MaxConcurrent),
+		stop:  make(chan struct{}),
+	}
+
+	maxIdle := (options.MaxConcurrent + options.Browsers - 1) / options.Browsers
+	for i := 0; i < options.Browsers; i++ {
+		b := &pooledBrowser{path: options.BrowserPath, maxIdle: maxIdle, hijack: hijack}
+		if err := b.launch(); err != nil {
+			pool.close()
+			return nil, err
+		}
+		pool.browsers = append(pool.browsers, b)
+	}
+
+	go pool.checkHealth(options.HealthInterval)
+
+	return pool, nil
+}
+
+// acquire waits for a free render slot and returns a page on the least busy
+// browser. Every acquired page must be released.
+func (p *browserPool) acquire(ctx context.Context) (*pooledPage, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for a browser: %w", ctx.Err())
+	}
+
+	page, err := p.leastBusy().page()
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return page, nil
+}
+
+// release returns a page to the pool. Pages whose render failed are closed
+// rather than reused, since their state is unknown.
+func (p *browserPool) release(page *pooledPage, reuse bool) {
+	page.owner.release(page, reuse)
+	<-p.slots
+}
+
+func (p *browserPool) leastBusy() *pooledBrowser {
+	var best *pooledBrowser
+	bestActive := 0
+	for _, b := range p.browsers {
+		b.mu.Lock()
+		active := b.active
+		b.mu.Unlock()
+		if best == nil || active < bestActive {
+			best, bestActive = b, active
+		}
+	}
+	return best
+}
+
+func (p *browserPool) checkHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			for i, b := range p.browsers {
+				b.mu.Lock()
+				if !b.healthy() {
+					log.Printf("Browser %d is not responding, relaunching", i)
+					if err := b.relaunch(); err != nil {
+						log.Printf("Failed to relaunch browser %d: %v", i, err)
+					}
+				}
+				b.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (p *browserPool) close() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	for _, b := range p.browsers {
+		b.mu.Lock()
+		b.shutdown()
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+// launch starts the browser. Callers hold b.mu, except during pool setup.
+func (b *pooledBrowser) launch() error {
+	l := launcher.New().
+		Bin(b.path).
+		Headless(true).
+		Set("no-sandbox").
+		Set("disable-dev-shm-usage").
+		// Requests the hijack router does not see, such as WebSockets, go
+		// to a proxy that is not there, loopback addresses included.
+		Set("proxy-server", "http://127.0.0.1:1").
+		Set("proxy-bypass-list", "<-loopback>")
+
+	url, err := l.Launch()
+	if err != nil {
+		return fmt.Errorf("failed to launch browser: %w", err)
+	}
+
+	browser := rod.New().ControlURL(url)
+	if err := browser.Connect(); err != nil {
+		l.Kill()
+		return fmt.Errorf("failed to connect to browser: %w", err)
+	}
+
+	router := browser.HijackRequests()
+	if err := router.Add("*", "", b.hijack); err != nil {
+		browser.Close()
+		l.Kill()
+		return fmt.Errorf("failed to intercept browser requests: %w", err)
+	}
+	go router.Run()
+
+	b.launcher = l
+	b.browser = browser
+	b.generation++
+	return nil
+}
+
+func (b *pooledBrowser) relaunch() error {
+	b.shutdown()
+	return b.launch()
+}
+
+func (b *pooledBrowser) shutdown() {
+	if b.browser != nil {
+		b.browser.Timeout(healthCheckTimeout).Close()
+	}
+	if b.launcher != nil {
+		b.launcher.Kill()
+		b.launcher.Cleanup()
+	}
+	b.browser = nil
+	b.launcher = nil
+	b.idle = nil
+}
+
+func (b *pooledBrowser) healthy() bool {
+	if b.browser == nil {
+		return false
+	}
+	_, err := proto.BrowserGetVersion{}.Call(b.browser.Timeout(healthCheckTimeout))
+	return err == nil
+}
+
+// page returns an idle page, or opens one, relaunching the browser if it
+// has died.
+func (b *pooledBrowser) page() (*pooledPage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n := len(b.idle); n > 0 {
+		page := b.idle[n-1]
+		b.idle = b.idle[:n-1]
+		b.active++
+		return &pooledPage{Page: page, owner: b, generation: b.generation}, nil
+	}
+
+	if !b.healthy() {
+		if err := b.relaunch(); err != nil {
+			return nil, err
+		}
+	}
+
+	page, err := b.browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open page: %w", err)
+	}
+
+	b.active++
+	return &pooledPage{Page: page, owner: b, generation: b.generation}, nil
+}
+
+func (b *pooledBrowser) release(page *pooledPage, reuse bool) {
+	if reuse {
+		// Previews change the viewport; PDFs expect the default.
+		if err := (proto.EmulationClearDeviceMetricsOverride{}).Call(page.Timeout(pageCloseTimeout)); err != nil {
+			reuse = false
+		}
+	}
+
+	b.mu.Lock()
+	b.active--
+	if reuse && page.generation == b.generation && len(b.idle) < b.maxIdle {
+		b.idle = append(b.idle, page.Page)
+		b.mu.Unlock()
+		return
+	}
+	b.mu.Unlock()
+
+	page.Timeout(pageCloseTimeout).Close()
+}
@@ -0,0 +1,49 @@
+package pdf
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+)
+
+func generateQRCodeDataURI(content string, size int, level qrcode.RecoveryLevel) (string, error) {
+	png, err := qrcode.Encode(content, level, size)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+// parseQRSize reads the qr_size template setting, falling back to the default
+// for anything missing or outside a sensible pixel range.
+func parseQRSize(value string) int {
+	size, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || size < minQRSize || size > maxQRSize {
+		return defaultQRSize
+	}
+	return size
+}
+
+// parseQRLevel maps the qr_error_correction template setting (L, M, Q or H)
+// to a recovery level. Medium is a good default for printed certificates.
+func parseQRLevel(value string) qrcode.RecoveryLevel {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "L", "LOW":
+		return qrcode.Low
+	case "Q", "HIGH":
+		return qrcode.High
+	case "H", "HIGHEST":
+		return qrcode.Highest
+	default:
+		return qrcode.Medium
+	}
+}
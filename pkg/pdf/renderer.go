@@ -0,0 +1,115 @@
+package pdf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrRendererUnavailable is returned for templates that need a renderer the
+// service is running without, such as HTML templates when the browser is
+// disabled.
+var ErrRendererUnavailable = errors.New("renderer unavailable")
+
+// Renderer turns a certificate template and its data into a PDF, raster
+// images or a PNG preview. Errors wrapping ErrInvalidTemplate recur on every
+// attempt. GenerateImages leaves nil the images whose format the renderer
+// cannot produce.
+type Renderer interface {
+	GenerateWithTemplate(ctx context.Context, templateName string, data map[string]string) ([]byte, error)
+	GenerateImages(ctx context.Context, templateName string, data map[string]string, options []ImageOptions) ([][]byte, error)
+	GeneratePreview(ctx context.Context, templateName string, data map[string]string) ([]byte, error)
+	TemplateFields(templateName string) ([]string, error)
+	ValidateTemplate(templateName string, images map[string]string) ([]TemplateProblem, error)
+	Close() error
+}
+
+var (
+	_ Renderer = (*HTMLGenerator)(nil)
+	_ Renderer = (*OverlayRenderer)(nil)
+	_ Renderer = (*Router)(nil)
+)
+
+// Router renders each template with the renderer for its file type:
+// overlay layouts (.json) with the overlay renderer and everything else as
+// HTML.
+type Router struct {
+	html    Renderer
+	overlay Renderer
+}
+
+// NewRouter creates a Router. html may be nil, in which case HTML templates
+// fail with ErrRendererUnavailable.
+func NewRouter(html, overlay Renderer) *Router {
+	return &Router{html: html, overlay: overlay}
+}
+
+func (r *Router) GenerateWithTemplate(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	renderer, err := r.rendererFor(templateName)
+	if err != nil {
+		return nil, err
+	}
+	return renderer.GenerateWithTemplate(ctx, templateName, data)
+}
+
+func (r *Router) GenerateImages(ctx context.Context, templateName string, data map[string]string, options []ImageOptions) ([][]byte, error) {
+	renderer, err := r.rendererFor(templateName)
+	if err != nil {
+		return nil, err
+	}
+	return renderer.GenerateImages(ctx, templateName, data, options)
+}
+
+func (r *Router) GeneratePreview(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	renderer, err := r.rendererFor(templateName)
+	if err != nil {
+		return nil, err
+	}
+	return renderer.GeneratePreview(ctx, templateName, data)
+}
+
+func (r *Router) TemplateFields(templateName string) ([]string, error) {
+	renderer, err := r.rendererFor(templateName)
+	if err != nil {
+		return nil, err
+	}
+	return renderer.TemplateFields(templateName)
+}
+
+func (r *Router) ValidateTemplate(templateName string, images map[string]string) ([]TemplateProblem, error) {
+	if IsOverlayTemplate(templateName) {
+		return r.overlay.ValidateTemplate(templateName, images)
+	}
+	if r.html == nil {
+		return []TemplateProblem{{Field: "template_name", Message: "HTML templates cannot be rendered while the browser is disabled"}}, nil
+	}
+	return r.html.ValidateTemplate(templateName, images)
+}
+
+func (r *Router) Close() error {
+	var errs []error
+	for _, renderer := range []Renderer{r.html, r.overlay} {
+		if renderer != nil {
+			errs = append(errs, renderer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Router) rendererFor(templateName string) (Renderer, error) {
+	if IsOverlayTemplate(templateName) {
+		return r.overlay, nil
+	}
+	if r.html == nil {
+		return nil, fmt.Errorf("%w: %s is an HTML template and the browser is disabled", ErrRendererUnavailable, templateName)
+	}
+	return r.html, nil
+}
+
+// IsOverlayTemplate reports whether a template is an overlay layout rather
+// than HTML.
+func IsOverlayTemplate(templateName string) bool {
+	return strings.EqualFold(filepath.Ext(templateName), ".json")
+}
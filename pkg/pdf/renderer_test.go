@@ -0,0 +1,150 @@
+package pdf
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeRenderer records the templates it is asked to render.
+type fakeRenderer struct {
+	name   string
+	calls  []string
+	closed bool
+}
+
+func (f *fakeRenderer) record(method, templateName string) {
+	f.calls = append(f.calls, method+" "+templateName)
+}
+
+func (f *fakeRenderer) GenerateWithTemplate(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	f.record("GenerateWithTemplate", templateName)
+	return []byte(f.name), nil
+}
+
+func (f *fakeRenderer) GenerateImages(ctx context.Context, templateName string, data map[string]string, options []ImageOptions) ([][]byte, error) {
+	f.record("GenerateImages", templateName)
+	return [][]byte{[]byte(f.name)}, nil
+}
+
+func (f *fakeRenderer) GeneratePreview(ctx context.Context, templateName string, data map[string]string) ([]byte, error) {
+	f.record("GeneratePreview", templateName)
+	return []byte(f.name), nil
+}
+
+func (f *fakeRenderer) TemplateFields(templateName string) ([]string, error) {
+	f.record("TemplateFields", templateName)
+	return []string{f.name}, nil
+}
+
+func (f *fakeRenderer) ValidateTemplate(templateName string, images map[string]string) ([]TemplateProblem, error) {
+	f.record("ValidateTemplate", templateName)
+	return nil, nil
+}
+
+func (f *fakeRenderer) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestRouterDispatch(t *testing.T) {
+	ctx := context.Background()
+	methods := map[string]func(r *Router, templateName string) (string, error){
+		"GenerateWithTemplate": func(r *Router, templateName string) (string, error) {
+			output, err := r.GenerateWithTemplate(ctx, templateName, nil)
+			return string(output), err
+		},
+		"GenerateImages": func(r *Router, templateName string) (string, error) {
+			images, err := r.GenerateImages(ctx, templateName, nil, []ImageOptions{{Format: ImagePNG}})
+			if err != nil {
+				return "", err
+			}
+			return string(images[0]), nil
+		},
+		"GeneratePreview": func(r *Router, templateName string) (string, error) {
+			output, err := r.GeneratePreview(ctx, templateName, nil)
+			return string(output), err
+		},
+		"TemplateFields": func(r *Router, templateName string) (string, error) {
+			fields, err := r.TemplateFields(templateName)
+			if err != nil {
+				return "", err
+			}
+			return fields[0], nil
+		},
+	}
+
+	tests := []struct {
+		templateName string
+		withoutHTML  bool
+		want         string // the renderer used, or "" for ErrRendererUnavailable
+	}{
+		{templateName: "certificate.html", want: "html"},
+		{templateName: "certificate.htm", want: "html"},
+		{templateName: "layout.json", want: "overlay"},
+		{templateName: "LAYOUT.JSON", want: "overlay"},
+		{templateName: "layout.json.html", want: "html"},
+		{templateName: "layout.json", withoutHTML: true, want: "overlay"},
+		{templateName: "certificate.html", withoutHTML: true},
+	}
+
+	for _, tt := range tests {
+		for method, call := range methods {
+			html, overlay := &fakeRenderer{name: "html"}, &fakeRenderer{name: "overlay"}
+			router := NewRouter(html, overlay)
+			if tt.withoutHTML {
+				router = NewRouter(nil, overlay)
+			}
+
+			got, err := call(router, tt.templateName)
+			if tt.want == "" {
+				if !errors.Is(err, ErrRendererUnavailable) {
+					t.Errorf("%s(%q) without HTML = %q, %v; want ErrRendererUnavailable", method, tt.templateName, got, err)
+				}
+				if len(overlay.calls) > 0 {
+					t.Errorf("%s(%q) without HTML called the overlay renderer", method, tt.templateName)
+				}
+				continue
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("%s(%q) = %q, %v; want the %s renderer", method, tt.templateName, got, err, tt.want)
+			}
+			if calls := len(html.calls) + len(overlay.calls); calls != 1 {
+				t.Errorf("%s(%q) made %d renderer calls, want 1", method, tt.templateName, calls)
+			}
+		}
+	}
+}
+
+func TestRouterValidateTemplate(t *testing.T) {
+	html, overlay := &fakeRenderer{name: "html"}, &fakeRenderer{name: "overlay"}
+	router := NewRouter(html, overlay)
+	for _, templateName := range []string{"certificate.html", "layout.json"} {
+		if problems, err := router.ValidateTemplate(templateName, nil); err != nil || len(problems) > 0 {
+			t.Errorf("ValidateTemplate(%q) = %v, %v", templateName, problems, err)
+		}
+	}
+	if len(html.calls) != 1 || len(overlay.calls) != 1 {
+		t.Errorf("html calls %v, overlay calls %v; want one each", html.calls, overlay.calls)
+	}
+
+	// Without a browser, HTML templates are reported as a problem to fix
+	// rather than an error.
+	router = NewRouter(nil, overlay)
+	problems, err := router.ValidateTemplate("certificate.html", nil)
+	if err != nil || len(problems) != 1 || problems[0].Field != "template_name" {
+		t.Errorf("ValidateTemplate without HTML = %v, %v; want one template_name problem", problems, err)
+	}
+}
+
+func TestRouterClose(t *testing.T) {
+	html, overlay := &fakeRenderer{name: "html"}, &fakeRenderer{name: "overlay"}
+	if err := NewRouter(html, overlay).Close(); err != nil || !html.closed || !overlay.closed {
+		t.Errorf("Close = %v; html closed %v, overlay closed %v", err, html.closed, overlay.closed)
+	}
+
+	overlay = &fakeRenderer{name: "overlay"}
+	if err := NewRouter(nil, overlay).Close(); err != nil || !overlay.closed {
+		t.Errorf("Close without HTML = %v; overlay closed %v", err, overlay.closed)
+	}
+}
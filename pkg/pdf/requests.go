@@ -0,0 +1,70 @@
+package pdf
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+const assetHost = "assets.invalid"
+
+// AssetURL is the only place a page can load files from while it renders:
+// AssetURL + name serves the file that name refers to as an image (under
+// images/, then the templates directory, then the asset store). Every other
+// request is blocked, so a template cannot reach the network or read local
+// files. Images set in the template config arrive as data: URIs, which the
+// browser resolves without a request.
+const AssetURL = "https://" + assetHost + "/"
+
+// pageResponse is the answer to a request made by a page being rendered.
+type pageResponse struct {
+	blocked     bool
+	status      int
+	contentType string
+	body        []byte
+}
+
+// respond answers a page's request for u from the template source, or
+// blocks it.
+func (s templateSource) respond(u *url.URL) pageResponse {
+	if u == nil || u.Scheme != "https" || u.Host != assetHost {
+		return pageResponse{blocked: true}
+	}
+
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" || !filepath.IsLocal(name) {
+		return pageResponse{status: http.StatusNotFound}
+	}
+	data, ok, err := s.image(name)
+	if err != nil {
+		return pageResponse{status: http.StatusInternalServerError}
+	}
+	if !ok {
+		return pageResponse{status: http.StatusNotFound}
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return pageResponse{status: http.StatusOK, contentType: contentType, body: data}
+}
+
+// hijack answers every request a page makes, with respond.
+func (s templateSource) hijack(h *rod.Hijack) {
+	response := s.respond(h.Request.URL())
+	if response.blocked {
+		h.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
+		return
+	}
+	h.Response.Payload().ResponseCode = response.status
+	if response.contentType != "" {
+		h.Response.SetHeader("Content-Type", response.contentType)
+	}
+	h.Response.SetBody(response.body)
+}
@@ -0,0 +1,61 @@
+package pdf
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRespondOnlyServesAssets(t *testing.T) {
+	root := t.TempDir()
+	templatesDir := filepath.Join(root, "templates")
+	for path, data := range map[string]string{
+		filepath.Join(root, "secret.txt"):                 "secret",
+		filepath.Join(templatesDir, "images", "logo.svg"): "<svg/>",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := templateSource{templatesDir: templatesDir, assets: testAssets{"Lazy Dog.ttf": "font"}}
+
+	tests := []struct {
+		url         string
+		blocked     bool
+		status      int
+		contentType string
+		body        string
+	}{
+		{url: AssetURL + "logo.svg", status: http.StatusOK, contentType: "image/svg+xml", body: "<svg/>"},
+		{url: AssetURL + "Lazy%20Dog.ttf?v=1", status: http.StatusOK, contentType: "font/ttf", body: "font"},
+		{url: AssetURL + "missing.png", status: http.StatusNotFound},
+		{url: AssetURL + "..%2Fsecret.txt", status: http.StatusNotFound},
+		{url: AssetURL, status: http.StatusNotFound},
+		{url: "http://" + assetHost + "/logo.svg", blocked: true},
+		{url: "https://fonts.example.com/css/lazy-dog", blocked: true},
+		{url: "http://169.254.169.254/latest/meta-data/", blocked: true},
+		{url: "http://localhost:8080/api/v1/queue/dead", blocked: true},
+		{url: "file://" + filepath.Join(root, "secret.txt"), blocked: true},
+		{url: "https://" + assetHost + ".example.com/logo.svg", blocked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := source.respond(u)
+			if got.blocked != tt.blocked || got.status != tt.status {
+				t.Fatalf("respond = blocked %v, status %d; want blocked %v, status %d", got.blocked, got.status, tt.blocked, tt.status)
+			}
+			if got.contentType != tt.contentType || string(got.body) != tt.body {
+				t.Errorf("respond = %q %q, want %q %q", got.contentType, got.body, tt.contentType, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateProblem is one reason a template would fail to render or render
+// wrongly. Field is the config key or template field at fault.
+type TemplateProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidateTemplate checks that a template exists, parses, and only uses
+// fields of CertificateData, and that every image in images, keyed by the
+// config setting that names it, exists. The error is only for failures to
+// look templates or images up.
+func (g *HTMLGenerator) ValidateTemplate(templateName string, images map[string]string) ([]TemplateProblem, error) {
+	var problems []TemplateProblem
+
+	keys := make([]string, 0, len(images))
+	for key := range images {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		filename := images[key]
+		_, ok, err := g.image(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up image %s: %w", filename, err)
+		}
+		if !ok {
+			problems = append(problems, TemplateProblem{Field: key, Message: fmt.Sprintf("image %s not found", filename)})
+		}
+	}
+
+	content, ok, err := g.lookup(templateName, templateName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up template %s: %w", templateName, err)
+	}
+	if !ok {
+		return append(problems, TemplateProblem{Field: "template_name", Message: fmt.Sprintf("template %s not found", templateName)}), nil
+	}
+
+	tmpl, err := template.New(templateName).Option("missingkey=zero").Parse(string(content))
+	if err != nil {
+		return append(problems, TemplateProblem{Field: "template_name", Message: err.Error()}), nil
+	}
+
+	fieldProblems := checkFields(tmpl)
+	problems = append(problems, fieldProblems...)
+
+	// Unknown fields already explain why execution would fail; otherwise
+	// run the template once to catch errors that only show up at runtime.
+	if len(fieldProblems) == 0 {
+		if err := tmpl.Execute(io.Discard, sampleData()); err != nil {
+			problems = append(problems, TemplateProblem{Field: "template_name", Message: err.Error()})
+		}
+	}
+
+	return problems, nil
+}
+
+// checkFields reports every {{.Field}} a template uses that CertificateData
+// does not have.
+func checkFields(tmpl *template.Template) []TemplateProblem {
+	known := make(map[string]reflect.Kind)
+	dataType := reflect.TypeOf(CertificateData{})
+	for i := 0; i < dataType.NumField(); i++ {
+		known[dataType.Field(i).Name] = dataType.Field(i).Type.Kind()
+	}
+
+	used := walkTemplate(tmpl).used
+	fields := make([]string, 0, len(used))
+	for field := range used {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var problems []TemplateProblem
+	for _, field := range fields {
+		name, rest, nested := strings.Cut(field, ".")
+		kind, ok := known[name]
+		switch {
+		case !ok:
+			problems = append(problems, TemplateProblem{Field: name, Message: "is not a field the generator provides"})
+		case kind == reflect.Map && strings.Contains(rest, "."):
+			problems = append(problems, TemplateProblem{Field: field, Message: fmt.Sprintf("%s values are text and have no fields", name)})
+		case kind == reflect.String && nested:
+			problems = append(problems, TemplateProblem{Field: field, Message: fmt.Sprintf("%s is text and has no field %s", name, rest)})
+		}
+	}
+	return problems
+}
+
+// sampleData fills every field so that a trial execution goes down the
+// branches a real certificate would.
+func sampleData() CertificateData {
+	var data CertificateData
+	value := reflect.ValueOf(&data).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if value.Field(i).Kind() == reflect.String {
+			value.Field(i).SetString(value.Type().Field(i).Name)
+		}
+	}
+	return data
+}
@@ -0,0 +1,110 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported file format, expected .csv or .xlsx")
+
+// Read returns every row of a CSV or XLSX file as strings, choosing the
+// parser from the file extension. For XLSX files sheet selects the worksheet;
+// an empty sheet means the first one. Cells are trimmed and rows are padded
+// to the same width.
+func Read(r io.Reader, filename, sheet string) ([][]string, error) {
+	var rows [][]string
+	var err error
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		rows, err = readCSV(r)
+	case ".xlsx":
+		rows, err = readXLSX(r, sheet)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	for i, row := range rows {
+		for j := range row {
+			row[j] = strings.TrimSpace(row[j])
+		}
+		for len(row) < width {
+			row = append(row, "")
+		}
+		rows[i] = row
+	}
+
+	return rows, nil
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	// Spreadsheet programs often save CSV with a UTF-8 byte order mark.
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	return rows, nil
+}
+
+func readXLSX(r io.Reader, sheet string) ([][]string, error) {
+	file, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open XLSX: %w", err)
+	}
+	defer file.Close()
+
+	if sheet == "" {
+		sheets := file.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, fmt.Errorf("workbook has no sheets")
+		}
+		sheet = sheets[0]
+	}
+
+	rows, err := file.GetRows(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet %q: %w", sheet, err)
+	}
+	return rows, nil
+}
+
+// ColumnIndex converts a column letter such as "A" or "AB" to a 0-based
+// index. It returns -1 if name is not a column letter.
+func ColumnIndex(name string) int {
+	if name == "" || len(name) > 3 {
+		return -1
+	}
+	index := 0
+	for _, c := range strings.ToUpper(name) {
+		if c < 'A' || c > 'Z' {
+			return -1
+		}
+		index = index*26 + int(c-'A'+1)
+	}
+	return index - 1
+}
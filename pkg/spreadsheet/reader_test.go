@@ -0,0 +1,143 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want [][]string
+	}{
+		{
+			name: "header and rows",
+			data: "Name,Email\nAda,ada@example.com\n",
+			want: [][]string{{"Name", "Email"}, {"Ada", "ada@example.com"}},
+		},
+		{
+			name: "byte order mark",
+			data: "\xef\xbb\xbfName,Email\nAda,ada@example.com\n",
+			want: [][]string{{"Name", "Email"}, {"Ada", "ada@example.com"}},
+		},
+		{
+			name: "cells trimmed and short rows padded",
+			data: " Name , Email ,Course\n Ada ,ada@example.com\n",
+			want: [][]string{{"Name", "Email", "Course"}, {"Ada", "ada@example.com", ""}},
+		},
+		{
+			name: "quoted commas",
+			data: "Name,Event\n\"Lovelace, Ada\",Hackathon\n",
+			want: [][]string{{"Name", "Event"}, {"Lovelace, Ada", "Hackathon"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(strings.NewReader(tt.data), "recipients.CSV", "")
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	file := excelize.NewFile()
+	file.SetSheetRow("Sheet1", "A1", &[]interface{}{"Name", "Email"})
+	file.SetSheetRow("Sheet1", "A2", &[]interface{}{" Ada ", "ada@example.com"})
+	if _, err := file.NewSheet("Late"); err != nil {
+		t.Fatal(err)
+	}
+	file.SetSheetRow("Late", "A1", &[]interface{}{"Name", "Email", "Event"})
+	file.SetSheetRow("Late", "A2", &[]interface{}{"Grace"})
+	var buf bytes.Buffer
+	if err := file.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		sheet   string
+		want    [][]string
+		wantErr bool
+	}{
+		{name: "first sheet", want: [][]string{{"Name", "Email"}, {"Ada", "ada@example.com"}}},
+		{name: "named sheet", sheet: "Late", want: [][]string{{"Name", "Email", "Event"}, {"Grace", "", ""}}},
+		{name: "missing sheet", sheet: "Nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(bytes.NewReader(buf.Bytes()), "recipients.xlsx", tt.sheet)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Read = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+		want     error
+	}{
+		{name: "unknown extension", filename: "recipients.txt", data: "Name\n", want: ErrUnsupportedFormat},
+		{name: "no extension", filename: "recipients", data: "Name\n", want: ErrUnsupportedFormat},
+		{name: "malformed CSV", filename: "recipients.csv", data: "Name\n\"Ada\n"},
+		{name: "not a workbook", filename: "recipients.xlsx", data: "Name,Email\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tt.data), tt.filename, "")
+			if err == nil {
+				t.Fatal("Read succeeded, want an error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Read = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"A", 0},
+		{"b", 1},
+		{"Z", 25},
+		{"AA", 26},
+		{"AB", 27},
+		{"ZZ", 701},
+		{"AAA", 702},
+		{"", -1},
+		{"A1", -1},
+		{"Email", -1},
+		{"ABCD", -1},
+	}
+	for _, tt := range tests {
+		if got := ColumnIndex(tt.name); got != tt.want {
+			t.Errorf("ColumnIndex(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}